@@ -0,0 +1,137 @@
+package gibero
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Batch collects parameter rows of one DML statement which are sent to the
+// server in a single execute message by TConn.ExecBatch
+//
+//	batch := gibero.NewBatch("INSERT INTO T(ID, NAME) VALUES (?, ?)")
+//	batch.Add(1, "a")
+//	batch.Add(2, "b")
+//	err := conn.Raw(func(dc any) error {
+//		res, err := dc.(*gibero.TConn).ExecBatch(batch)
+//		...
+//	})
+type Batch struct {
+	query string
+	rows  [][]driver.Value
+}
+
+func NewBatch(query string) *Batch {
+	return &Batch{query: query}
+}
+
+// Add appends one row of parameters. Values are checked the same way
+// as the arguments of Exec.
+func (batch *Batch) Add(args ...any) error {
+	if len(batch.rows) > 0 && len(args) != len(batch.rows[0]) {
+		return fmt.Errorf("batch row has %d parameters, expected %d", len(args), len(batch.rows[0]))
+	}
+	row := make([]driver.Value, len(args))
+	for a, arg := range args {
+		val, err := checkParam(a+1, arg)
+		if err != nil {
+			return err
+		}
+		row[a] = val
+	}
+	batch.rows = append(batch.rows, row)
+	return nil
+}
+
+func (batch *Batch) Len() int {
+	return len(batch.rows)
+}
+
+// BatchResult reports the outcome of every row of a batch
+type BatchResult struct {
+	// RowsAffected holds the affected row count of each batch row
+	RowsAffected []int64
+	// Errors maps the index of each failed batch row to its error
+	Errors map[int]error
+}
+
+// Err returns the error of the first failed row
+func (result *BatchResult) Err() error {
+	first := -1
+	for row := range result.Errors {
+		if first < 0 || row < first {
+			first = row
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	return fmt.Errorf("batch row %d: %w", first, result.Errors[first])
+}
+
+func (batch *Batch) binders(tibero *Tibero) ([]uint32, [][]ParamBinder, error) {
+	var ptypes []uint32
+	rows := make([][]ParamBinder, len(batch.rows))
+	for index, args := range batch.rows {
+		ps := &PrepareStatement{sql: batch.query, tibero: tibero}
+		err := setting(ps, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("batch row %d: %w", index, err)
+		}
+		row := make([]ParamBinder, 0, len(args))
+		for ele := ps.params.Front(); ele != nil; ele = ele.Next() {
+			binder := ele.Value.(ParamBinder)
+			if _, ok := binder.(*OutBinder); ok {
+				return nil, nil, fmt.Errorf("batch row %d: sql.Out is not supported in a batch", index)
+			}
+			row = append(row, binder)
+		}
+		if ptypes == nil {
+			ptypes = make([]uint32, len(row))
+		}
+		for a, binder := range row {
+			ptype := uint32(PARAM_MODE_IN | int(binder.paramType())<<8)
+			if args[a] == nil {
+				continue
+			}
+			if ptypes[a] == 0 {
+				ptypes[a] = ptype
+			} else if ptypes[a] != ptype {
+				return nil, nil, fmt.Errorf("batch row %d: parameter %d has type %T unlike the previous rows", index, a+1, args[a])
+			}
+		}
+		rows[index] = row
+	}
+	for a := range ptypes {
+		if ptypes[a] == 0 {
+			ptypes[a] = uint32(PARAM_MODE_IN | DT_VARCHAR<<8)
+		}
+	}
+	return ptypes, rows, nil
+}
+
+// ExecBatch executes every row of the batch in one round-trip.
+// A server error of an individual row is reported in BatchResult.Errors,
+// the returned error is reserved for failures of the whole batch.
+func (conn *TConn) ExecBatch(batch *Batch) (*BatchResult, error) {
+	if batch.Len() == 0 {
+		return &BatchResult{Errors: map[int]error{}}, nil
+	}
+	ptypes, rows, err := batch.binders(conn.tibero)
+	if err != nil {
+		return nil, err
+	}
+	cmd := BatchCMD(batch.query, conn.autoComit, ptypes, rows)
+	conn.tibero.logger.Debug("execute batch", "sql", batch.query, "rows", batch.Len())
+	start := time.Now()
+	msg, err := conn.tibero.write(cmd)
+	conn.tibero.metrics.statement(statementKind(batch.query), start, err)
+	if err != nil {
+		return nil, err
+	}
+	reply, ok := msg.(*TbMsgBatchUpdateReply)
+	if !ok {
+		return nil, unexpectedReply(msg)
+	}
+	return &BatchResult{RowsAffected: reply.counts, Errors: reply.errors}, nil
+}
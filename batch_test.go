@@ -0,0 +1,57 @@
+package gibero
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	assert := require.New(t)
+	batch := NewBatch("insert into T(ID, NAME) values (?, ?)")
+	assert.Nil(batch.Add(1, "a"))
+	assert.Nil(batch.Add(2, nil))
+	assert.EqualError(batch.Add(3), "batch row has 1 parameters, expected 2")
+	assert.EqualError(batch.Add(3, "c", 4), "batch row has 3 parameters, expected 2")
+	assert.Equal(2, batch.Len())
+	ptypes, rows, err := batch.binders(nil)
+	assert.Nil(err)
+	assert.Equal([]uint32{0x101, 0x301}, ptypes)
+	assert.Equal([][]ParamBinder{{IntegerBinder(1), StringBinder("a")}, {IntegerBinder(2), StringBinder("")}}, rows)
+	data := BatchCMD(batch.query, 1, ptypes, rows)
+	expect := "0000000f00000058" + "0000000000000000" +
+		// query
+		"00000025" + hex.EncodeToString([]byte(batch.query)) + "000000" +
+		// auto commit, parameter and row counts
+		"00000001" + "00000002" + "00000002" +
+		// parameter types: NUMBER and VARCHAR
+		"00000101" + "00000301" +
+		// row 0: 1, 'a'
+		"0302c18100000000" + "01610000" +
+		// row 1: 2, NULL
+		"0302c18200000000" + "00000000"
+	assert.Equal(expect, hex.EncodeToString(data))
+
+	mixed := NewBatch("insert into T(ID) values (?)")
+	assert.Nil(mixed.Add(1))
+	assert.Nil(mixed.Add("x"))
+	_, _, err = mixed.binders(nil)
+	assert.NotNil(err)
+
+	writer := CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig32(2)
+	writer.WriteBig64(1)
+	writer.WriteBig64(0)
+	writer.WriteBig32(1)
+	writer.WriteBig32(1)
+	writer.WriteBig32(1)
+	writer.WriteDBString("23000")
+	writer.WriteDBString("unique constraint violated")
+	reply := &TbMsgBatchUpdateReply{}
+	reply.deserialize(CreateReader(nil, writer.Data(), 0))
+	result := &BatchResult{RowsAffected: reply.counts, Errors: reply.errors}
+	assert.Equal([]int64{1, 0}, result.RowsAffected)
+	assert.EqualError(result.Err(), "batch row 1: TBR-1: unique constraint violated")
+}
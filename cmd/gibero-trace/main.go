@@ -0,0 +1,59 @@
+// Command gibero-trace prints the messages of a trace recorded with
+// TConnector.SetTraceSink.
+//
+//	gibero-trace [-hex] file.trace
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sankooc/gibero"
+)
+
+func main() {
+	dump := flag.Bool("hex", false, "dump the bytes of every message")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: gibero-trace [-hex] file.trace")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	err := run(flag.Arg(0), *dump, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gibero-trace:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, dump bool, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := gibero.NewTraceReader(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s\n", record.Time.Format("15:04:05.000000"), record.Describe())
+		if dump {
+			fmt.Fprint(out, hex.Dump(record.Data))
+		}
+	}
+}
@@ -2,9 +2,12 @@ package gibero
 
 import (
 	"container/list"
+	"database/sql"
 	"encoding/base64"
+	"fmt"
 	"os"
 	"os/user"
+	"strings"
 	"time"
 )
 
@@ -18,8 +21,18 @@ const (
 	CLOSE_CSR     Tibero_CMD_CODE = 22
 	CLOSE_SESSION Tibero_CMD_CODE = 28
 	CLOSE_LOB     Tibero_CMD_CODE = 50
+	XA_START      Tibero_CMD_CODE = 60
+	XA_END        Tibero_CMD_CODE = 61
+	XA_PREPARE    Tibero_CMD_CODE = 62
+	XA_COMMIT     Tibero_CMD_CODE = 63
+	XA_ROLLBACK   Tibero_CMD_CODE = 64
+	XA_FORGET     Tibero_CMD_CODE = 65
+	XA_RECOVER    Tibero_CMD_CODE = 66
 	CLOSE_XA      Tibero_CMD_CODE = 67
+	AUTH          Tibero_CMD_CODE = 137
+	CHANGE_PASSWD Tibero_CMD_CODE = 138
 	CLOSE_TID     Tibero_CMD_CODE = 226
+	SSL_REQUEST   Tibero_CMD_CODE = 284
 )
 
 type TbclntInfoParam struct {
@@ -76,6 +89,37 @@ func CLOSE_TID_CMD() []byte {
 	return CMDtail(writer)
 }
 
+// XA_CMD drives a branch of a distributed transaction
+func XA_CMD(code Tibero_CMD_CODE, xid *Xid, flags uint32, timeout uint32) []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(code.code())
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	xid.serialize(writer)
+	writer.WriteBig32(flags)
+	writer.WriteBig32(timeout)
+	return CMDtail(writer)
+}
+
+func XA_RECOVER_CMD(flags uint32) []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(XA_RECOVER.code())
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	writer.WriteBig32(flags)
+	return CMDtail(writer)
+}
+
+// SSLRequestCMD asks the server to continue the connection over TLS,
+// the handshake starts once it answered with OkReply
+func SSLRequestCMD() []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(SSL_REQUEST.code())
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	return writer.Data()
+}
+
 func PKExchangeCmd() []byte {
 	writer := CreateWriter()
 	writer.WriteBig32(282)
@@ -95,6 +139,38 @@ func SQLCMD(autoComit uint32, prefetch uint32, sql string) []byte {
 	return CMDtail(writer)
 }
 
+func FetchCMD(csrId uint32, fetchSize uint32) []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(8)
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	writer.WriteBig32(csrId)
+	writer.WriteBig32(fetchSize)
+	return CMDtail(writer)
+}
+
+// BatchCMD executes sql once for every row of binders. The parameter
+// types are sent once and must be the same for all the rows.
+func BatchCMD(sql string, autoComit uint32, ptypes []uint32, rows [][]ParamBinder) []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(15)
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	writer.WriteDBString(sql)
+	writer.WriteBig32(autoComit)
+	writer.WriteBig32(uint32(len(ptypes)))
+	writer.WriteBig32(uint32(len(rows)))
+	for _, ptype := range ptypes {
+		writer.WriteBig32(ptype)
+	}
+	for _, row := range rows {
+		for _, binder := range row {
+			binder.deserialize(writer)
+		}
+	}
+	return CMDtail(writer)
+}
+
 func PrepareStatementCMD(sql string, autoComit uint32, prefetch uint32, flag bool) {
 	var paramCount uint32 = 1
 	writer := CreateWriter()
@@ -121,11 +197,10 @@ func generateC(id uint32, val string) *TbclntInfoParam {
 }
 
 // AUTH_REQ_WITH_VER
-func AuthRequestCmd(username string, password string, dbname string, program string, publicK []byte) []byte {
+func AuthRequestCmd(username string, password string, dbname string, program string, publicK []byte) ([]byte, error) {
 	user, _ := user.Current()
 	suser := user.Username
 	hostname, _ := os.Hostname()
-	printFormat("user %s %s", suser, hostname)
 	var params [7]*TbclntInfoParam
 	params[0] = generateC(0, "-1")
 	params[1] = generateC(1, program)
@@ -147,10 +222,13 @@ func AuthRequestCmd(username string, password string, dbname string, program str
 	params2[9] = generateC(0, "")
 	params2[10] = generateC(0, "")
 
-	enPassword, _ := RSA_Encrypt([]byte(password), publicK)
+	enPassword, err := RSA_Encrypt([]byte(password), publicK)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt password: %w", err)
+	}
 	base64Password := base64.StdEncoding.EncodeToString(enPassword)
 	writer := CreateWriter()
-	writer.WriteBig32(137)
+	writer.WriteBig32(AUTH.code())
 	writer.WriteBig32(0)
 	writer.WriteBig64(0)
 	// 2 16 0
@@ -164,7 +242,28 @@ func AuthRequestCmd(username string, password string, dbname string, program str
 	writer.WriteNLS(11, params2[:])
 	//
 	writer.WriteBig32(1)
-	return CMDtail(writer)
+	return CMDtail(writer), nil
+}
+
+// ChangePasswordCmd replaces an expired password during the login, the
+// server answers like the auth request once the new password is set
+func ChangePasswordCmd(username string, password string, newPassword string, publicK []byte) ([]byte, error) {
+	enPassword, err := RSA_Encrypt([]byte(password), publicK)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt password: %w", err)
+	}
+	enNewPassword, err := RSA_Encrypt([]byte(newPassword), publicK)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt new password: %w", err)
+	}
+	writer := CreateWriter()
+	writer.WriteBig32(CHANGE_PASSWD.code())
+	writer.WriteBig32(0)
+	writer.WriteBig64(0)
+	writer.WriteDBString(username)
+	writer.WriteDBString(base64.StdEncoding.EncodeToString(enPassword))
+	writer.WriteDBString(base64.StdEncoding.EncodeToString(enNewPassword))
+	return CMDtail(writer), nil
 }
 
 func CommitCMD() []byte {
@@ -196,6 +295,9 @@ type PrepareStatement struct {
 	autoComit uint32
 	prefetch  uint32
 	tibero    *Tibero
+	conn      *TConn
+	// the transaction the statement was prepared in
+	tx *TTx
 }
 
 func (ps *PrepareStatement) addParam(binder ParamBinder) {
@@ -211,6 +313,31 @@ func (ps *PrepareStatement) setString(param string) {
 func (ps *PrepareStatement) setInteger(param int64) {
 	ps.addParam(IntegerBinder(param))
 }
+func (ps *PrepareStatement) setUinteger(param uint64) {
+	ps.addParam(UintegerBinder(param))
+}
+func (ps *PrepareStatement) setDecimal(param Decimal) error {
+	mantissa, negative, exponent, err := param.parts()
+	if err != nil {
+		return err
+	}
+	ps.addParam(DecimalBinder(ToNumber(mantissa, negative, exponent)))
+	return nil
+}
+func (ps *PrepareStatement) setBytes(param []byte) {
+	ps.addParam(BytesBinder(param))
+}
+func (ps *PrepareStatement) setIntervalYM(param IntervalYM) {
+	ps.addParam(IntervalYMBinder(param))
+}
+func (ps *PrepareStatement) setIntervalDS(param IntervalDS) {
+	ps.addParam(IntervalDSBinder(param))
+}
+
+// null is sent as an empty character value
+func (ps *PrepareStatement) setNull() {
+	ps.addParam(StringBinder(""))
+}
 func (ps *PrepareStatement) setFloat32(param float32) {
 	ps.addParam(Float32Binder(param))
 }
@@ -222,6 +349,55 @@ func (ps *PrepareStatement) setTimestamp(param time.Time) {
 	ps.addParam(TimestampBinder(param))
 }
 
+// rowid parameters are sent in character form and converted by the server
+func (ps *PrepareStatement) setRowID(param RowID) {
+	ps.addParam(StringBinder(param))
+}
+
+func (ps *PrepareStatement) setBoolean(param bool) {
+	if ps.plsqlBoolean() {
+		ps.addParam(BooleanBinder(param))
+		return
+	}
+	var val int64 = 0
+	if param {
+		val = 1
+	}
+	ps.addParam(IntegerBinder(val))
+}
+
+func (ps *PrepareStatement) plsqlBoolean() bool {
+	mode := BOOL_AUTO
+	if ps.tibero != nil && ps.tibero.dsn != nil && ps.tibero.dsn.boolMode != "" {
+		mode = ps.tibero.dsn.boolMode
+	}
+	switch mode {
+	case BOOL_PLSQL:
+		return true
+	case BOOL_NUMBER:
+		return false
+	}
+	return isPLSQLBlock(ps.sql)
+}
+
+// firstKeyword returns the first word of sql in upper case
+func firstKeyword(sql string) string {
+	str := strings.TrimLeft(sql, " \t\r\n(")
+	if end := strings.IndexAny(str, " \t\r\n(;"); end >= 0 {
+		str = str[:end]
+	}
+	return strings.ToUpper(str)
+}
+
+// isPLSQLBlock reports whether sql is an anonymous block or a procedure call
+func isPLSQLBlock(sql string) bool {
+	switch firstKeyword(sql) {
+	case "BEGIN", "DECLARE", "CALL":
+		return true
+	}
+	return false
+}
+
 func (ps *PrepareStatement) setDate(param time.Time) {
 	ps.addParam(DateBinder(param))
 }
@@ -253,7 +429,10 @@ func (ps *PrepareStatement) deserialize() []byte {
 		ele := ps.params.Front()
 		for {
 			binder := (ele.Value).(ParamBinder)
-			paramMode := 1
+			paramMode := PARAM_MODE_IN
+			if out, ok := binder.(*OutBinder); ok {
+				paramMode = out.mode()
+			}
 			var ptype uint32 = uint32((paramMode & 255) | (int(binder.paramType()) << 8))
 			writer.WriteBig32(ptype)
 			binder.deserialize(writer)
@@ -269,8 +448,25 @@ func (ps *PrepareStatement) deserialize() []byte {
 }
 
 func (ps *PrepareStatement) exec() (interface{}, error) {
+	if ps.tx != nil && ps.tx.done {
+		return nil, sql.ErrTxDone
+	}
+	if ps.conn != nil {
+		ps.autoComit = ps.conn.autoComit
+	}
 	raw := ps.deserialize()
-	return ps.tibero.write(raw)
+	params := 0
+	if ps.params != nil {
+		params = ps.params.Len()
+	}
+	ps.tibero.logger.Debug("execute", "sql", ps.sql, "params", params, "autocommit", ps.autoComit)
+	start := time.Now()
+	msg, err := ps.tibero.write(raw)
+	ps.tibero.metrics.statement(statementKind(ps.sql), start, err)
+	if err != nil {
+		ps.tibero.logger.Debug("execute failed", "sql", ps.sql, "error", err)
+	}
+	return msg, err
 }
 
 func (ps *PrepareStatement) doQuery() (*TbMsgExecutePrefetchReply, error) {
@@ -280,10 +476,11 @@ func (ps *PrepareStatement) doQuery() (*TbMsgExecutePrefetchReply, error) {
 		return nil, err
 	}
 	info, ok := msg.(*TbMsgExecutePrefetchReply)
-	if ok {
-		return info, nil
+	if !ok {
+		return nil, unexpectedReply(msg)
 	}
-	return nil, nil
+	info.bind(ps.tibero)
+	return info, nil
 }
 
 func (ps *PrepareStatement) doExec() (*TbMsgExecuteCountReply, error) {
@@ -292,11 +489,27 @@ func (ps *PrepareStatement) doExec() (*TbMsgExecuteCountReply, error) {
 	if err != nil {
 		return nil, err
 	}
-	info, ok := msg.(*TbMsgExecuteCountReply)
-	if ok {
+	switch info := msg.(type) {
+	case *TbMsgExecuteCountReply:
 		return info, nil
+	case *TbMsgExecutePsmReply:
+		err = ps.assignOutParams(info.outParams)
+		if err != nil {
+			return nil, err
+		}
+		return &info.TbMsgExecuteCountReply, nil
+	case *TbMsgExecuteReturningReply:
+		id, err := ps.assignReturning(info.returnParams)
+		if err != nil {
+			return nil, err
+		}
+		info.lastInsertId = id
+		return &info.TbMsgExecuteCountReply, nil
+	case *OkReply:
+		// statements without a row count such as DDL
+		return &TbMsgExecuteCountReply{Message: info.Message}, nil
 	}
-	return nil, nil
+	return nil, unexpectedReply(msg)
 }
 
 type ParamBinder interface {
@@ -311,7 +524,7 @@ func (binder BytesBinder) paramType() byte {
 }
 
 func (binder BytesBinder) deserialize(writer *ByteWriter) {
-	// writer.WriteDBMinLenString(string(binder))
+	writer.WriteDBBytes(binder)
 }
 
 type StringBinder string
@@ -331,7 +544,27 @@ func (binder IntegerBinder) paramType() byte {
 }
 
 func (binder IntegerBinder) deserialize(writer *ByteWriter) {
-	writer.WriteDBFloat(float64(binder), 32)
+	writer.WriteDBInteger(int64(binder))
+}
+
+type UintegerBinder uint64
+
+func (binder UintegerBinder) paramType() byte {
+	return DT_NUMBER
+}
+
+func (binder UintegerBinder) deserialize(writer *ByteWriter) {
+	writer.WriteDBNumber(EncodeUint64(uint64(binder)))
+}
+
+type DecimalBinder []byte
+
+func (binder DecimalBinder) paramType() byte {
+	return DT_NUMBER
+}
+
+func (binder DecimalBinder) deserialize(writer *ByteWriter) {
+	writer.WriteDBNumber(binder)
 }
 
 type Float32Binder float32
@@ -364,6 +597,46 @@ func (binder TimestampBinder) paramType() byte {
 	return 7
 }
 
+type IntervalYMBinder IntervalYM
+
+func (binder IntervalYMBinder) paramType() byte {
+	return DT_ITV_YTM
+}
+
+func (binder IntervalYMBinder) deserialize(writer *ByteWriter) {
+	var data [5]byte
+	fromIntervalYM(data[:], IntervalYM(binder))
+	writer.WriteDBBytes(data[:])
+}
+
+type IntervalDSBinder IntervalDS
+
+func (binder IntervalDSBinder) paramType() byte {
+	return DT_ITV_DTS
+}
+
+func (binder IntervalDSBinder) deserialize(writer *ByteWriter) {
+	var data [11]byte
+	fromIntervalDS(data[:], IntervalDS(binder))
+	writer.WriteDBBytes(data[:])
+}
+
+type BooleanBinder bool
+
+func (binder BooleanBinder) paramType() byte {
+	return DT_BOOLEAN
+}
+
+func (binder BooleanBinder) deserialize(writer *ByteWriter) {
+	var val byte = 0
+	if binder {
+		val = 1
+	}
+	writer.WriteByte(1)
+	writer.WriteByte(val)
+	writer.putPad(pad(2))
+}
+
 type DateBinder time.Time
 
 func (binder DateBinder) deserialize(writer *ByteWriter) {
@@ -1,7 +1,16 @@
 package gibero
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/pem"
+	"io"
 	"testing"
 	"time"
 
@@ -44,6 +53,38 @@ func Test_prepareStatement(t *testing.T) {
 	}
 }
 
+func TestNumberBinders(t *testing.T) {
+	assert := require.New(t)
+	mantissa, negative, exponent, err := Decimal("-0.5").parts()
+	assert.Nil(err)
+	cases := []struct {
+		binder ParamBinder
+		expect string
+	}{
+		{IntegerBinder(12345), "0504c38197ad0000"},
+		{UintegerBinder(12345), "0504c38197ad0000"},
+		{UintegerBinder(18446744073709551615), "0c0bca92acc3ac87a589b7908f000000"},
+		{DecimalBinder(ToNumber(mantissa, negative, exponent)), "04033f4ef0000000"},
+		{Float64Binder(-0.5), "04033f4ef0000000"},
+	}
+	for _, c := range cases {
+		writer := CreateWriter()
+		c.binder.deserialize(writer)
+		assert.Equal(c.expect, hex.EncodeToString(writer.Data()), "%T", c.binder)
+	}
+}
+
+func TestParamTooLong(t *testing.T) {
+	assert := require.New(t)
+	ps := &PrepareStatement{sql: "insert into T values (?, ?)"}
+	long := make([]byte, MAX_PARAM_SIZE+1)
+	err := setting(ps, []driver.Value{"ok", long})
+	assert.ErrorIs(err, ErrParamTooLong)
+	assert.Contains(err.Error(), "parameter 2")
+	assert.ErrorIs(setting(ps, []driver.Value{string(long)}), ErrParamTooLong)
+	assert.Nil(setting(ps, []driver.Value{long[:MAX_PARAM_SIZE]}))
+}
+
 func TestCMD(t *testing.T) {
 	assert := require.New(t)
 	{
@@ -60,3 +101,273 @@ func TestCMD(t *testing.T) {
 		// assert.Equal(expect, hex.EncodeToString(buf[:]), "PKExchangeCmd")
 	}
 }
+
+func TestBooleanBinding(t *testing.T) {
+	assert := require.New(t)
+	assert.True(isPLSQLBlock("  begin proc(?); end;"))
+	assert.True(isPLSQLBlock("CALL proc(?)"))
+	assert.True(isPLSQLBlock("DECLARE v BOOLEAN; BEGIN NULL; END;"))
+	assert.False(isPLSQLBlock("update t set flag = ?"))
+	{
+		ps := PrepareStatement{sql: "update t set flag = ?"}
+		ps.setBoolean(true)
+		assert.Equal(IntegerBinder(1), ps.params.Front().Value)
+	}
+	{
+		ps := PrepareStatement{sql: "begin proc(?); end;"}
+		ps.setBoolean(true)
+		writer := CreateWriter()
+		binder := ps.params.Front().Value.(ParamBinder)
+		assert.Equal(byte(DT_BOOLEAN), binder.paramType())
+		binder.deserialize(writer)
+		assert.Equal("01010000", hex.EncodeToString(writer.Data()))
+	}
+	{
+		dsn := DsnConvert("tibero://u:p@127.0.0.1:8629/db?bool=number")
+		ps := PrepareStatement{sql: "begin proc(?); end;", tibero: &Tibero{dsn: dsn}}
+		ps.setBoolean(false)
+		assert.Equal(IntegerBinder(0), ps.params.Front().Value)
+	}
+	_, err := NewConnector("tibero://u:p@127.0.0.1:8629/db?bool=yes")
+	assert.EqualError(err, `invalid bool mode "yes"`)
+}
+
+func TestOutParams(t *testing.T) {
+	assert := require.New(t)
+	var total int64
+	var note *string
+	var maybe *int64
+	var when *time.Time
+	label := "in"
+	ps := PrepareStatement{sql: "begin proc(?, ?, ?, ?, ?, ?); end;", autoComit: 1}
+	err := setting(&ps, []driver.Value{
+		int64(7),
+		sql.Out{Dest: &total},
+		sql.Out{Dest: &label, In: true},
+		sql.Out{Dest: &note},
+		sql.Out{Dest: &maybe},
+		sql.Out{Dest: &when},
+	})
+	assert.Nil(err)
+	modes := []uint32{}
+	for ele := ps.params.Front(); ele != nil; ele = ele.Next() {
+		binder := ele.Value.(ParamBinder)
+		mode := uint32(PARAM_MODE_IN)
+		if out, ok := binder.(*OutBinder); ok {
+			mode = uint32(out.mode())
+		}
+		modes = append(modes, mode|uint32(binder.paramType())<<8)
+	}
+	assert.Equal([]uint32{0x101, 0x102, 0x303, 0x302, 0x102, 0x702}, modes)
+
+	writer := CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig32(0)
+	writer.WriteBig32(1)
+	writer.WriteBig32(5)
+	writer.WriteBig32(DT_NUMBER)
+	writer.WriteDBBytes(EncodeInt64(42))
+	writer.WriteBig32(DT_VARCHAR)
+	writer.WriteDBBytes([]byte("out"))
+	writer.WriteBig32(DT_VARCHAR)
+	writer.WriteDBBytes(nil)
+	writer.WriteBig32(DT_NUMBER)
+	writer.WriteDBBytes(EncodeInt64(-3))
+	at := time.Date(2023, 7, 21, 10, 15, 20, 500, time.Local)
+	writer.WriteBig32(DT_TIMESTAMP)
+	writer.WriteDBBytes(EncodeTimestamp(at))
+	reply := &TbMsgExecutePsmReply{}
+	reply.deserialize(CreateReader(nil, writer.Data(), 0))
+	assert.Nil(ps.assignOutParams(reply.outParams))
+	assert.Equal(int64(42), total)
+	assert.Equal("out", label)
+	assert.Nil(note)
+	assert.Equal(int64(-3), *maybe)
+	assert.True(at.Equal(*when))
+}
+
+func TestCursorOut(t *testing.T) {
+	assert := require.New(t)
+	var cur Cursor
+	ps := PrepareStatement{sql: "begin open_rows(?); end;"}
+	assert.Nil(setting(&ps, []driver.Value{sql.Out{Dest: &cur}}))
+	assert.Equal(byte(DT_RSET), ps.params.Front().Value.(ParamBinder).paramType())
+
+	value := CreateWriter()
+	value.WriteBig32(5)
+	value.WriteBig32(1)
+	value.WriteDBString("ID")
+	for _, v := range []uint32{DT_NUMBER, 10, 0, 0, 22} {
+		value.WriteBig32(v)
+	}
+	writer := CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig64(0)
+	writer.WriteBig32(1)
+	writer.WriteBig32(DT_RSET)
+	writer.WriteDBBytes(value.Data())
+	reply := &TbMsgExecutePsmReply{}
+	reply.deserialize(CreateReader(nil, writer.Data(), 0))
+	assert.Nil(ps.assignOutParams(reply.outParams))
+	assert.Equal(uint32(5), cur.csrId)
+	assert.Equal([]string{"ID"}, cur.Columns())
+
+	chunk := []byte{0, 0, 0, 0}
+	for _, id := range []int64{7, 8} {
+		num := EncodeInt64(id)
+		chunk = append(chunk, byte(len(num)))
+		chunk = append(chunk, num...)
+		chunk = append(chunk, 0, 0, 0)
+	}
+	fetch := &TbMsgFetchReply{rowCnt: 2, isFetchCompleted: 1, rowChunk: append(chunk, 0)}
+	rows, err := fetch.rows(cur.colMeta)
+	assert.Nil(err)
+	cur.resultSet = rows
+	cur.isFetchCompleted = true
+	dest := make([]driver.Value, 1)
+	assert.Nil(cur.Next(dest))
+	assert.Equal(int64(7), dest[0])
+	assert.Nil(cur.Next(dest))
+	assert.Equal(int64(8), dest[0])
+	assert.Equal(io.EOF, cur.Next(dest))
+	assert.Nil(cur.Close())
+}
+
+type cursorGauge struct {
+	NopMetrics
+	open int
+}
+
+func (gauge *cursorGauge) CursorOpened() { gauge.open++ }
+func (gauge *cursorGauge) CursorClosed() { gauge.open-- }
+
+func TestCursorClose(t *testing.T) {
+	assert := require.New(t)
+	gauge := &cursorGauge{}
+	server := &okServer{}
+	tibero := &Tibero{DBServer: server, metrics: connMetrics{metrics: gauge}}
+	cur := &Cursor{tibero: tibero, csrId: 5}
+	tibero.cursorOpened()
+	assert.Nil(cur.Close())
+	assert.Nil(cur.Close())
+	assert.Equal(0, gauge.open)
+	assert.Len(server.sent, 1)
+
+	// cursors left open are reported closed with the connection
+	conn := &TConn{tibero: tibero}
+	open := &Cursor{tibero: tibero, csrId: 6}
+	tibero.cursorOpened()
+	tibero.cursorOpened()
+	assert.Equal(2, gauge.open)
+	assert.Nil(conn.Close())
+	assert.Equal(0, gauge.open)
+	assert.Nil(open.Close())
+	assert.Equal(0, gauge.open)
+}
+
+func returningReply(count uint32, params ...[][]byte) []byte {
+	writer := CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig32(0)
+	writer.WriteBig32(count)
+	writer.WriteBig32(uint32(len(params)))
+	for _, rows := range params {
+		writer.WriteBig32(DT_NUMBER)
+		writer.WriteBig32(uint32(len(rows)))
+		for _, row := range rows {
+			writer.WriteDBBytes(row)
+		}
+	}
+	return writer.Data()
+}
+
+func TestReturningInto(t *testing.T) {
+	assert := require.New(t)
+	assert.True(isReturningDML("insert into t(a) values (seq.nextval) returning a into ?"))
+	assert.True(isReturningDML(" UPDATE t SET a = a + 1\nRETURNING a INTO ?"))
+	assert.False(isReturningDML("begin update t set a = 1 returning a into :x; end;"))
+	assert.False(isReturningDML("select returning into from t"))
+	assert.False(isReturningDML("UPDATE t SET note = 'returning x into y'"))
+	assert.False(isReturningDML("UPDATE t SET note = 'it''s returning x into y' WHERE id = ?"))
+	assert.False(isReturningDML("DELETE FROM t -- returning a into ?\nWHERE id = ?"))
+	assert.False(isReturningDML(`UPDATE t SET "RETURNING" = 1 /* returning a into ? */`))
+	assert.True(isReturningDML("UPDATE t SET note = 'x' /* audit */ RETURNING id INTO ?"))
+	assert.Equal("a   b", stripLiterals("a 'x' b"))
+
+	var id int64
+	server := &okServer{replies: []testReply{{msgType: 17, body: returningReply(1, [][]byte{EncodeInt64(11)})}}}
+	conn := &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	stmt, _ := conn.Prepare("insert into t(a) values (seq.nextval) returning a into ?")
+	result, err := stmt.Exec([]driver.Value{sql.Out{Dest: &id}})
+	assert.Nil(err)
+	assert.Equal(int64(11), id)
+	lastId, err := result.LastInsertId()
+	assert.Nil(err)
+	assert.Equal(int64(11), lastId)
+	binder := stmt.(*PrepareStatement).params.Front().Value.(*OutBinder)
+	assert.Equal(PARAM_MODE_RETURN, binder.mode())
+
+	var ids []int64
+	server.replies = []testReply{{msgType: 17, body: returningReply(2, [][]byte{EncodeInt64(3), EncodeInt64(4)})}}
+	stmt, _ = conn.Prepare("update t set b = 1 returning a into ?")
+	result, err = stmt.Exec([]driver.Value{sql.Out{Dest: &ids}})
+	assert.Nil(err)
+	assert.Equal([]int64{3, 4}, ids)
+	count, _ := result.RowsAffected()
+	assert.Equal(int64(2), count)
+	_, err = result.LastInsertId()
+	assert.Equal(ErrLastInsertIdNotSupported, err)
+
+	server.replies = []testReply{{msgType: 17, body: returningReply(2, [][]byte{EncodeInt64(3), EncodeInt64(4)})}}
+	_, err = stmt.Exec([]driver.Value{sql.Out{Dest: &id}})
+	assert.NotNil(err)
+}
+
+func publicPEM(t *testing.T, bits int) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	require.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestServerKey(t *testing.T) {
+	assert := require.New(t)
+	key := publicPEM(t, 2048)
+	session := base64.StdEncoding.EncodeToString(append(append([]byte{}, key...), "garbage"...))
+	formatted, err := FormatPEM(session)
+	assert.Nil(err)
+	assert.Equal(key, formatted)
+	_, err = FormatPEM("not base64!")
+	assert.NotNil(err)
+	_, err = FormatPEM(base64.StdEncoding.EncodeToString(key[:len(key)-30]))
+	assert.EqualError(err, "invalid server public key: no END PUBLIC KEY marker")
+	for value, strict := range map[string]bool{"true": true, "1": true, "FALSE": false} {
+		connector, err := NewConnector("tibero://u:p@127.0.0.1:8629/db?strictkey=" + value)
+		assert.Nil(err)
+		assert.Equal(strict, connector.dsn.strictKey, value)
+	}
+	_, err = NewConnector("tibero://u:p@127.0.0.1:8629/db?strictkey=yes")
+	assert.EqualError(err, `invalid strictkey "yes"`)
+
+	pin, err := PublicKeyFingerprint(key)
+	assert.Nil(err)
+	assert.Nil(checkFingerprint(pin))
+	assert.NotNil(checkFingerprint("md5/abc"))
+	assert.Nil(verifyServerKey(key, true, pin))
+	other, _ := PublicKeyFingerprint(publicPEM(t, 2048))
+	assert.NotNil(verifyServerKey(key, false, other))
+
+	weak := publicPEM(t, 1024)
+	assert.Nil(verifyServerKey(weak, false, ""))
+	assert.NotNil(verifyServerKey(weak, true, ""))
+	assert.NotNil(verifyServerKey(append(append([]byte{}, key...), "trailing"...), true, ""))
+
+	_, err = BytesToPublicKey([]byte("no pem"))
+	assert.NotNil(err)
+	_, err = AuthRequestCmd("user", "password", "db", "go-tibero", []byte("no pem"))
+	assert.NotNil(err)
+	cmd, err := AuthRequestCmd("user", "password", "db", "go-tibero", key)
+	assert.Nil(err)
+	assert.Equal(uint32(137), binary.BigEndian.Uint32(cmd))
+}
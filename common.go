@@ -1,9 +1,13 @@
 package gibero
 
 import (
-	"encoding/hex"
-	"log"
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"fmt"
 	"net"
+	"sync"
+	"time"
 )
 
 type Serializable interface {
@@ -14,32 +18,22 @@ type Deserializable interface {
 }
 
 type DBServer interface {
-	Connect()
-	readMessage() (*Message, *ByteReader)
-	writeTo(data []byte)
+	Connect(ctx context.Context) error
+	readMessage() (*Message, *ByteReader, error)
+	writeTo(data []byte) error
 	flush()
+	close() error
 }
 
-func printFormat(format string, v ...any) {
-	if TB_VERBOSE {
-		log.Printf(format, v...)
-	}
+// deadliner is implemented by servers whose connection accepts an I/O
+// deadline, the zero time clears it
+type deadliner interface {
+	setDeadline(t time.Time) error
 }
-func printLine(str string) {
-	if TB_VERBOSE {
-		log.Println(str)
-	}
 
-}
-func PrintHex(tag string, data []byte) {
-	hexStr := hex.EncodeToString(data)
-	size := len(data)
-	printFormat("tag [%s] size [%d] hex:[%s] \n", tag, size, hexStr)
-}
 func ReadMsg(reader *ByteReader) (*Message, *EReply) {
 	meta := &Message{}
 	meta.deserialize(reader)
-	printFormat("msg-type:=[%d]", meta.MsgType)
 	if meta.MsgType == 76 {
 		return nil, buildErr(meta, reader)
 	}
@@ -48,7 +42,6 @@ func ReadMsg(reader *ByteReader) (*Message, *EReply) {
 func buildErr(meta *Message, reader *ByteReader) *EReply {
 	rp := &EReply{Message: meta}
 	rp.deserialize(reader)
-	printFormat("response error [%+v]\n", rp)
 	return rp
 }
 
@@ -58,6 +51,20 @@ type TiberoDSN struct {
 	password string
 	address  string
 	dbname   string
+	boolMode string
+	// ssl dsn parameters, loaded into tlsConfig by loadTLS
+	sslMode       string
+	sslRootCert   string
+	sslCert       string
+	sslKey        string
+	sslServerName string
+	tlsConfig     *tls.Config
+	// pinned fingerprint of the server public key, see PublicKeyFingerprint
+	serverKey string
+	// reject malformed or weak server public keys
+	strictKey bool
+	// the first malformed parameter, reported by OpenConnector
+	paramErr error
 }
 
 type Tibero struct {
@@ -66,123 +73,368 @@ type Tibero struct {
 	dsn         *TiberoDSN
 	client      string
 	connectInfo *ConnectMessage
+	// receives the warnings sent along with replies
+	onWarning func(Warning)
+	// set once a read or write on the connection failed
+	broken bool
+	// chooses a new password when the login failed with an expired one
+	changePassword func(username string) (string, error)
+	// set once the login replaced the expired password
+	passwordChanged bool
+	logger          connLogger
+	metrics         connMetrics
+	// cursors holding rows on the server, reported closed with the connection
+	openCursors int
+}
+
+type messageDecoder struct {
+	create func(meta *Message) Deserializable
+	// asynchronous messages may arrive before the reply of any command
+	async bool
+}
+
+var (
+	messageRegistry = map[uint32]*messageDecoder{}
+	registryMu      sync.RWMutex
+)
+
+// registerMessage makes handle decode the message code with create
+func registerMessage(code uint32, create func(meta *Message) Deserializable, async bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	messageRegistry[code] = &messageDecoder{create: create, async: async}
+}
+
+func lookupMessage(code uint32) (*messageDecoder, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	decoder, ok := messageRegistry[code]
+	return decoder, ok
+}
+
+// MessageHandler receives the body of a message registered with RegisterMessage
+type MessageHandler func(msgType uint32, body []byte)
+
+// RegisterMessage accepts the messages of type msgType that a server sends on
+// its own ahead of the replies, such as the notices of newer versions, and
+// passes their body to handle instead of failing the command with an
+// UnexpectedMessageError. The types decoded by the driver can not be replaced.
+func RegisterMessage(msgType uint32, handle MessageHandler) error {
+	if _, ok := lookupMessage(msgType); ok {
+		return fmt.Errorf("message type %d is already registered", msgType)
+	}
+	registerMessage(msgType, func(meta *Message) Deserializable {
+		return &rawMessage{Message: meta, handle: handle}
+	}, true)
+	return nil
+}
+
+// rawMessage holds the body of a message registered with RegisterMessage
+type rawMessage struct {
+	*Message
+	body   []byte
+	handle MessageHandler
+}
+
+func (msg *rawMessage) deserialize(reader *ByteReader) {
+	msg.body = reader.read(reader.Total - reader.Cur)
+}
+
+func init() {
+	registerMessage(0, func(meta *Message) Deserializable { return &ConnectMessage{Message: meta} }, false)
+	registerMessage(2, func(meta *Message) Deserializable { return &SessionInfoMessage{Message: meta} }, false)
+	registerMessage(11, func(meta *Message) Deserializable { return &TbMsgExecutePrefetchReply{Message: meta} }, false)
+	registerMessage(12, func(meta *Message) Deserializable { return &TbMsgFetchReply{Message: meta} }, false)
+	registerMessage(13, func(meta *Message) Deserializable { return &TbMsgExecuteCountReply{Message: meta} }, false)
+	registerMessage(14, func(meta *Message) Deserializable {
+		return &TbMsgExecutePsmReply{TbMsgExecuteCountReply: TbMsgExecuteCountReply{Message: meta}}
+	}, false)
+	registerMessage(16, func(meta *Message) Deserializable { return &TbMsgBatchUpdateReply{Message: meta} }, false)
+	registerMessage(17, func(meta *Message) Deserializable {
+		return &TbMsgExecuteReturningReply{TbMsgExecuteCountReply: TbMsgExecuteCountReply{Message: meta}}
+	}, false)
+	registerMessage(68, func(meta *Message) Deserializable { return &TbMsgXaReply{Message: meta} }, false)
+	registerMessage(69, func(meta *Message) Deserializable { return &TbMsgXaRecoverReply{Message: meta} }, false)
+	registerMessage(75, func(meta *Message) Deserializable { return &OkReply{Message: meta} }, false)
+	registerMessage(76, func(meta *Message) Deserializable { return &EReply{Message: meta} }, false)
+	registerMessage(77, func(meta *Message) Deserializable { return &NoticeMessage{Message: meta} }, true)
+	registerMessage(283, func(meta *Message) Deserializable { return &PKExchangeMessage{Message: meta} }, false)
+}
+
+// UnexpectedMessageError reports a message the driver can not decode
+// or which is not a valid reply of the command sent
+type UnexpectedMessageError struct {
+	MsgType uint32
+	Tsn     uint64
+}
+
+func (e *UnexpectedMessageError) Error() string {
+	return fmt.Sprintf("unexpected message type %d (tsn %d)", e.MsgType, e.Tsn)
+}
+
+func unexpectedReply(msg interface{}) error {
+	if m, ok := msg.(interface{ header() *Message }); ok {
+		meta := m.header()
+		return &UnexpectedMessageError{MsgType: meta.MsgType, Tsn: meta.Tsn}
+	}
+	return fmt.Errorf("unexpected reply %T", msg)
 }
 
 func handle(meta *Message, reader *ByteReader) (interface{}, error) {
-	switch meta.MsgType {
-	case 0:
-		msg := &ConnectMessage{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 2:
-		msg := &SessionInfoMessage{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 11:
-		msg := &TbMsgExecutePrefetchReply{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 13:
-		msg := &TbMsgExecuteCountReply{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 75:
-		msg := &OkReply{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 76:
-		msg := &EReply{Message: meta}
-		msg.deserialize(reader)
-		return msg, nil
-	case 283:
-		msg := &PKExchangeMessage{Message: meta}
-		msg.deserialize(reader)
+	decoder, ok := lookupMessage(meta.MsgType)
+	if !ok {
+		return nil, &UnexpectedMessageError{MsgType: meta.MsgType, Tsn: meta.Tsn}
+	}
+	msg := decoder.create(meta)
+	msg.deserialize(reader)
+	return msg, nil
+}
+
+func (tibero *Tibero) write(cmd []byte) (interface{}, error) {
+	if tibero.broken {
+		return nil, driver.ErrBadConn
+	}
+	err := tibero.DBServer.writeTo(cmd)
+	if err != nil {
+		tibero.broken = true
+		tibero.logger.Error("write failed, connection closed", "error", err)
+		return nil, err
+	}
+	return tibero.readReply()
+}
+
+// readReply reads the reply of the last command. Asynchronous messages
+// received first are passed to onAsync and a server error is returned as error.
+func (tibero *Tibero) readReply() (interface{}, error) {
+	for {
+		meta, reader, err := tibero.DBServer.readMessage()
+		if err != nil {
+			tibero.broken = true
+			tibero.logger.Error("read failed, connection closed", "error", err)
+			return nil, err
+		}
+		msg, err := handle(meta, reader)
+		if reader.Err() != nil {
+			// the rest of the reply is lost, the stream can not be resynchronized
+			tibero.broken = true
+			tibero.logger.Error("malformed message, connection closed", "msgType", meta.MsgType, "tsn", meta.Tsn, "error", reader.Err())
+			return nil, reader.Err()
+		}
+		if err != nil {
+			// the reply of the command may still follow, the stream is out of step
+			tibero.broken = true
+			tibero.logger.Error("unexpected message, connection closed", "msgType", meta.MsgType, "tsn", meta.Tsn)
+			return nil, err
+		}
+		if decoder, _ := lookupMessage(meta.MsgType); decoder.async {
+			tibero.onAsync(msg)
+			continue
+		}
+		if ereply, ok := msg.(*EReply); ok {
+			return nil, ereply
+		}
+		if ok, isOk := msg.(*OkReply); isOk && ok.warningMsg != "" {
+			tibero.warn(Warning{Message: ok.warningMsg})
+		}
 		return msg, nil
 	}
+}
 
-	return nil, nil
+func (tibero *Tibero) onAsync(msg interface{}) {
+	switch m := msg.(type) {
+	case *NoticeMessage:
+		tibero.warn(Warning{Code: int(m.code), Message: m.text})
+	case *rawMessage:
+		m.handle(m.MsgType, m.body)
+	}
 }
 
-func (tibero *Tibero) write(cmd []byte) (interface{}, error) {
-	tibero.DBServer.writeTo(cmd)
-	meta, reader := tibero.DBServer.readMessage()
-	return handle(meta, reader)
+func (tibero *Tibero) warn(warning Warning) {
+	tibero.logger.Warn("server warning", "code", warning.Code, "message", warning.Message)
+	if tibero.onWarning != nil {
+		tibero.onWarning(warning)
+	}
+}
+
+// withDeadline runs the request/response of do under the deadline of ctx,
+// a timeout breaks the connection as any other I/O error does
+func (tibero *Tibero) withDeadline(ctx context.Context, do func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	server, can := tibero.DBServer.(deadliner)
+	if !ok || !can {
+		return do()
+	}
+	if err := server.setDeadline(deadline); err != nil {
+		tibero.broken = true
+		return driver.ErrBadConn
+	}
+	err := do()
+	if tibero.broken {
+		return driver.ErrBadConn
+	}
+	if err := server.setDeadline(time.Time{}); err != nil {
+		tibero.broken = true
+		return driver.ErrBadConn
+	}
+	return err
 }
 
-func (tibero *Tibero) connect() *EReply {
+func (tibero *Tibero) connect(ctx context.Context) (err error) {
+	stage := "connect"
+	defer func() {
+		if err != nil {
+			tibero.metrics.handshakeFailed(stage, err)
+		}
+	}()
 	{
-		printFormat("ready to connect")
-		tibero.DBServer.Connect()
-		meta, reader := tibero.DBServer.readMessage()
-		msg, _ := handle(meta, reader)
+		tibero.logger.Debug("connect", "address", tibero.dsn.address)
+		err := tibero.DBServer.Connect(ctx)
+		if err != nil {
+			return err
+		}
+		msg, err := tibero.readReply()
+		if err != nil {
+			return err
+		}
 		inf, ok := msg.(*ConnectMessage)
-		if ok {
-			tibero.connectInfo = inf
-		} else {
-			panic("failed to connect")
+		if !ok {
+			return unexpectedReply(msg)
+		}
+		tibero.connectInfo = inf
+		stage = "tls"
+		err = tibero.negotiateTLS()
+		if err != nil {
+			return err
 		}
 	}
+	stage = "key"
 	{
-		printFormat("ready to public key exchange")
+		tibero.logger.Debug("public key exchange")
 		cmd := PKExchangeCmd()
-		msg, _ := tibero.write(cmd)
+		msg, err := tibero.write(cmd)
+		if err != nil {
+			return err
+		}
 		inf, ok := msg.(*PKExchangeMessage)
-		if ok {
-			publicK := string([]byte(*inf.SessKey))
-			tibero.pem = FormatPEM(publicK)
-			printFormat("public key [%s]", string(tibero.pem))
+		if !ok {
+			return unexpectedReply(msg)
+		}
+		publicK := string([]byte(*inf.SessKey))
+		pem, err := FormatPEM(publicK)
+		if err != nil {
+			return err
 		}
+		tibero.logger.Debug("server public key", "pem", string(pem))
+		err = verifyServerKey(pem, tibero.dsn.strictKey, tibero.dsn.serverKey)
+		if err != nil {
+			return err
+		}
+		tibero.pem = pem
 	}
+	stage = "auth"
 	{
-		printFormat("ready to auth req")
+		tibero.logger.Debug("auth request", "user", tibero.dsn.username)
 		info := tibero.dsn
-		cmd := AuthRequestCmd(info.username, info.password, info.dbname, tibero.client, tibero.pem)
-		msg, _ := tibero.write(cmd)
-		_, ok := msg.(*SessionInfoMessage)
-		if ok {
-			printLine("auth success")
-		}
-		// SessionInfoMessage
-		// raw := tibero.DBServer.RequestAuth(cmd)
-		// PrintHex("connect-res", raw)
-		// res, err := reactAuthReq(raw)
-		// if err != nil {
-		// 	return err
-		// }
-		// log.Printf("object [%+v]\n", res)
-	}
-	// tibero.DBServer.state = 1
+		cmd, err := AuthRequestCmd(info.username, info.password, info.dbname, tibero.client, tibero.pem)
+		if err != nil {
+			return err
+		}
+		msg, err := tibero.write(cmd)
+		if err != nil && tibero.changePassword != nil && IsPasswordExpired(err) {
+			tibero.logger.Warn("password expired", "user", tibero.dsn.username)
+			msg, err = tibero.renewPassword()
+		}
+		if err != nil {
+			return err
+		}
+		session, ok := msg.(*SessionInfoMessage)
+		if !ok {
+			return unexpectedReply(msg)
+		}
+		tibero.logger = tibero.logger.with("session", session.sessionId)
+		tibero.logger.Info("connected", "user", tibero.dsn.username, "dbname", tibero.dsn.dbname)
+	}
 	return nil
 }
 
 func (tibero *Tibero) executeDirct(sql string) (interface{}, error) {
-	printFormat("do direct sql statement")
+	tibero.logger.Debug("execute", "sql", sql)
 	//TYPE_FORWARD_ONLY 1003
 	//CONCUR_READ_ONLY 1007
 	cmd := SQLCMD(1, 64000, sql)
-	return tibero.write(cmd)
+	start := time.Now()
+	msg, err := tibero.write(cmd)
+	tibero.metrics.statement(statementKind(sql), start, err)
+	return msg, err
+}
+
+func (tibero *Tibero) fetch(csrId uint32, colMeta []*TbColumnDesc) ([]*TbResultSet, bool, error) {
+	tibero.logger.Debug("fetch", "cursor", csrId)
+	cmd := FetchCMD(csrId, 64000)
+	start := time.Now()
+	msg, err := tibero.write(cmd)
+	if err != nil {
+		return nil, false, err
+	}
+	reply, ok := msg.(*TbMsgFetchReply)
+	if !ok {
+		return nil, false, unexpectedReply(msg)
+	}
+	rows, err := reply.rows(colMeta)
+	if err != nil {
+		tibero.logger.Error("malformed row chunk", "cursor", csrId, "error", err)
+		return nil, false, err
+	}
+	tibero.metrics.fetch(start, len(rows))
+	return rows, reply.isFetchCompleted != 0, nil
+}
+
+func (tibero *Tibero) closeCursor(csrId uint32) error {
+	tibero.logger.Debug("close cursor", "cursor", csrId)
+	_, err := tibero.write(CLOSE_CSR_CMD(csrId))
+	return err
+}
+
+// executeInTx runs a transaction control statement such as SET TRANSACTION
+// or SAVEPOINT without autocommit so it applies to the running transaction
+func (tibero *Tibero) executeInTx(sql string) error {
+	tibero.logger.Debug("execute", "sql", sql)
+	cmd := SQLCMD(0, 0, sql)
+	start := time.Now()
+	_, err := tibero.write(cmd)
+	tibero.metrics.statement(statementKind(sql), start, err)
+	return err
 }
 
 func (tibero *Tibero) commit() (interface{}, error) {
-	printFormat("do commit")
+	tibero.logger.Debug("commit")
 	cmd := CommitCMD()
-	return tibero.write(cmd)
+	start := time.Now()
+	msg, err := tibero.write(cmd)
+	tibero.metrics.statement("transaction", start, err)
+	return msg, err
 }
 
-func (tibero *Tibero) rollback() (interface{}, error) {
-	printFormat("do rollback")
-	var savepoint string = ""
+// rollback rolls back the transaction, or to savepoint when it is not empty
+func (tibero *Tibero) rollback(savepoint string) (interface{}, error) {
+	tibero.logger.Debug("rollback", "savepoint", savepoint)
 	cmd := RollbackCMD(savepoint)
-	return tibero.write(cmd)
+	start := time.Now()
+	msg, err := tibero.write(cmd)
+	tibero.metrics.statement("transaction", start, err)
+	return msg, err
 }
 
 func (tibero *Tibero) createPrepareStatement(sql string, autoComit uint32) *PrepareStatement {
-	printFormat("create sql %s autocomit %d", sql, autoComit)
+	tibero.logger.Debug("prepare", "sql", sql)
 	return &PrepareStatement{tibero: tibero, sql: sql, flag: false, autoComit: autoComit, prefetch: 0}
 }
 
 func CreateDB(host string, username string, password string, dbname string) *Tibero {
-	dsn := &TiberoDSN{username: username, password: password, address: "", dbname: dbname, protocal: "tcp"}
+	dsn := &TiberoDSN{username: username, password: password, address: "", dbname: dbname, protocal: "tcp", boolMode: BOOL_AUTO, sslMode: SSL_DISABLE}
 	addr, _ := net.ResolveTCPAddr("tcp", host)
 	server := &Singleton{TiberoDSN: dsn, addr: addr}
 	return &Tibero{client: "go-tibero", DBServer: server, dsn: dsn}
@@ -0,0 +1,240 @@
+package gibero
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var errTxInProgress = errors.New("transaction already in progress")
+
+// TConn is a physical connection to the server
+type TConn struct {
+	connector *TConnector
+	tibero    *Tibero
+	autoComit uint32
+	// the running transaction, nil in autocommit mode
+	tx *TTx
+	// savepoints of the running transaction in creation order
+	savepoints []string
+	// the XA branch associated between XAResource.Start and End
+	xaBranch *Xid
+	// warnings received since the connection was taken from the pool
+	warnings []Warning
+}
+
+// Warning is a warning or notice sent by the server along with a reply
+type Warning struct {
+	// Code is the server code of the notice, 0 when the server gave none
+	Code    int
+	Message string
+}
+
+func (warning Warning) String() string {
+	if warning.Code == 0 {
+		return warning.Message
+	}
+	return fmt.Sprintf("TBR-%d: %s", warning.Code, warning.Message)
+}
+
+// at most this many warnings are kept, older ones are dropped
+const maxWarnings = 100
+
+func (conn *TConn) addWarning(warning Warning) {
+	if len(conn.warnings) >= maxWarnings {
+		conn.warnings = conn.warnings[1:]
+	}
+	conn.warnings = append(conn.warnings, warning)
+	if conn.connector != nil && conn.connector.warningHandler != nil {
+		conn.connector.warningHandler(warning)
+	}
+}
+
+// Warnings returns the warnings received since the connection was taken
+// from the pool and clears them. It is reachable through sql.Conn.Raw:
+//
+//	conn.ExecContext(ctx, "CREATE OR REPLACE PROCEDURE ...")
+//	conn.Raw(func(dc any) error {
+//		warnings = dc.(*gibero.TConn).Warnings()
+//		return nil
+//	})
+func (conn *TConn) Warnings() []Warning {
+	warnings := conn.warnings
+	conn.warnings = nil
+	return warnings
+}
+
+func (conn *TConn) Prepare(query string) (driver.Stmt, error) {
+	ps := conn.tibero.createPrepareStatement(query, conn.autoComit)
+	ps.conn = conn
+	ps.tx = conn.tx
+	return ps, nil
+}
+
+func (conn *TConn) Close() error {
+	conn.tibero.closeCursors()
+	return conn.tibero.DBServer.close()
+}
+
+// CheckNamedValue implements driver.NamedValueChecker so values are bound
+// with their own Tibero type instead of being converted by database/sql
+func (conn *TConn) CheckNamedValue(nv *driver.NamedValue) error {
+	val, err := checkParam(nv.Ordinal, nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = val
+	return nil
+}
+
+func (conn *TConn) Begin() (driver.Tx, error) {
+	if conn.tx != nil || conn.xaBranch != nil {
+		return nil, errTxInProgress
+	}
+	conn.autoComit = 0
+	conn.tx = &TTx{conn: conn}
+	return conn.tx, nil
+}
+
+// BeginTx starts a transaction with the isolation level and access mode
+// of opts. Tibero supports READ COMMITTED and SERIALIZABLE, a read-only
+// transaction always reads a consistent snapshot.
+func (conn *TConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt, err := setTransactionSQL(opts)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if stmt != "" {
+		err = conn.tibero.executeInTx(stmt)
+		if err != nil {
+			conn.endTx()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+func setTransactionSQL(opts driver.TxOptions) (string, error) {
+	level := sql.IsolationLevel(opts.Isolation)
+	if opts.ReadOnly {
+		switch level {
+		case sql.LevelDefault, sql.LevelSerializable:
+			return "SET TRANSACTION READ ONLY", nil
+		}
+		return "", fmt.Errorf("isolation level %s is not supported for read-only transactions", level)
+	}
+	switch level {
+	case sql.LevelDefault:
+		return "", nil
+	case sql.LevelReadCommitted:
+		return "SET TRANSACTION ISOLATION LEVEL READ COMMITTED", nil
+	case sql.LevelSerializable:
+		return "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", nil
+	}
+	return "", fmt.Errorf("isolation level %s is not supported", level)
+}
+
+// endTx puts the connection back in autocommit mode
+func (conn *TConn) endTx() {
+	if conn.tx != nil {
+		conn.tx.done = true
+		conn.tx = nil
+	}
+	conn.savepoints = nil
+	conn.autoComit = 1
+}
+
+// TTx is the transaction returned by TConn.Begin
+type TTx struct {
+	conn *TConn
+	done bool
+}
+
+func (tx *TTx) Commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	defer tx.conn.endTx()
+	_, err := tx.conn.tibero.commit()
+	return err
+}
+
+func (tx *TTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	defer tx.conn.endTx()
+	_, err := tx.conn.tibero.rollback("")
+	return err
+}
+
+// Ping checks the connection with a round-trip to the server
+func (conn *TConn) Ping(ctx context.Context) error {
+	if conn.tibero.broken {
+		return driver.ErrBadConn
+	}
+	return conn.tibero.withDeadline(ctx, func() error {
+		msg, err := conn.tibero.write(SQLCMD(conn.autoComit, 64000, "SELECT 1 FROM DUAL"))
+		if conn.tibero.broken {
+			return driver.ErrBadConn
+		}
+		if err != nil {
+			return err
+		}
+		if reply, ok := msg.(*TbMsgExecutePrefetchReply); ok {
+			reply.bind(conn.tibero)
+			return reply.Close()
+		}
+		return nil
+	})
+}
+
+// ResetSession is called by database/sql before a pooled connection is
+// reused. A transaction left open is rolled back, an XA branch left
+// associated is ended with TMFAIL and rolled back, the connection is
+// discarded when that fails.
+func (conn *TConn) ResetSession(ctx context.Context) error {
+	if conn.tibero.broken {
+		return driver.ErrBadConn
+	}
+	err := conn.tibero.withDeadline(ctx, func() error {
+		if xid := conn.xaBranch; xid != nil {
+			xa := conn.XAResource()
+			err := xa.End(xid, TMFAIL)
+			if err == nil {
+				err = xa.Rollback(xid)
+			}
+			if err != nil {
+				conn.tibero.logger.Warn("abandoned xa branch not rolled back, connection discarded", "error", err)
+				return driver.ErrBadConn
+			}
+		}
+		if conn.tx != nil {
+			_, err := conn.tibero.rollback("")
+			if conn.tibero.broken {
+				return driver.ErrBadConn
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	conn.endTx()
+	conn.warnings = nil
+	return nil
+}
+
+// IsValid reports whether the connection can be returned to the pool
+func (conn *TConn) IsValid() bool {
+	return !conn.tibero.broken
+}
@@ -1,57 +1,126 @@
 package gibero
 
 import (
-	"encoding/hex"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
+	"time"
 )
 
 type Singleton struct {
 	*TiberoDSN
-	addr  *net.TCPAddr
-	conn  net.Conn
-	state int
+	addr   *net.TCPAddr
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	state  int
+	logger connLogger
+	// counts the bytes on the wire when set
+	metrics Metrics
 }
 
 func (m *Singleton) flush() {
-	bt, _ := ioutil.ReadAll(m.conn)
-	printFormat("extra %s \n", hex.EncodeToString(bt[:]))
+	bt, _ := ioutil.ReadAll(m.reader)
+	m.logger.packet("extra", bt)
 }
-func (m *Singleton) checkConnect() {
-	// if m.state < 1 {
-	// 	panic("disconnect")
-	// }
+func (m *Singleton) checkConnect() error {
+	if m.conn == nil {
+		return errors.New("not connected")
+	}
+	return nil
 }
 
-func (m *Singleton) readMessage() (*Message, *ByteReader) {
+// readMessage reads one 16 byte header and the body it announces
+func (m *Singleton) readMessage() (*Message, *ByteReader, error) {
+	err := m.checkConnect()
+	if err != nil {
+		return nil, nil, err
+	}
 	var mbt [16]byte
-	_, err := m.conn.Read(mbt[:])
+	_, err = io.ReadFull(m.reader, mbt[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := parseHeader(mbt[:])
 	if err != nil {
-		//log.Println("recv failed, err:", err)
-		panic(err)
+		return nil, nil, err
 	}
-	msg := &Message{}
-	msg.DeserializeFromBytes(mbt[:])
-	printFormat("msg-type:=[%d]", msg.MsgType)
-	extLen := msg.MsgBodySize
-	printFormat("response-size[%d] \n", extLen)
-	ext := make([]byte, extLen)
-	_, err = m.conn.Read(ext)
-	PrintHex("connect-res", ext)
+	ext := make([]byte, msg.MsgBodySize)
+	_, err = io.ReadFull(m.reader, ext)
 	if err != nil {
-		log.Println("recv failed, err:", err)
-		panic(err)
+		return nil, nil, err
 	}
-	return msg, CreateReader(m.conn, ext, 0)
+	m.logger.packet("receive", ext, "msgType", msg.MsgType, "tsn", msg.Tsn)
+	return msg, CreateReader(m.reader, ext, 0), nil
 }
 
-func (m *Singleton) Connect() {
-	conn, _ := net.DialTCP("tcp", nil, m.addr)
+func (m *Singleton) Connect(ctx context.Context) error {
+	if m.addr == nil {
+		return errors.New("unresolved server address")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr.String())
+	if err != nil {
+		return err
+	}
 	m.conn = conn
+	if m.metrics != nil {
+		m.conn = countingConn{Conn: conn, metrics: m.metrics}
+	}
+	m.reader = bufio.NewReader(m.conn)
+	m.writer = bufio.NewWriter(m.conn)
+	return nil
 }
-func (m *Singleton) writeTo(data []byte) {
-	m.checkConnect()
-	PrintHex("prewrite-cmd", data)
-	m.conn.Write(data)
+
+func (m *Singleton) setDeadline(t time.Time) error {
+	err := m.checkConnect()
+	if err != nil {
+		return err
+	}
+	return m.conn.SetDeadline(t)
+}
+
+// startTLS runs the TLS handshake over the established connection
+func (m *Singleton) startTLS(config *tls.Config) error {
+	err := m.checkConnect()
+	if err != nil {
+		return err
+	}
+	if m.reader.Buffered() > 0 {
+		return errors.New("unexpected data before tls handshake")
+	}
+	conn := tls.Client(m.conn, config)
+	err = conn.Handshake()
+	if err != nil {
+		return err
+	}
+	m.conn = conn
+	m.reader = bufio.NewReader(conn)
+	m.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// writeTo sends a whole command and flushes it at once
+func (m *Singleton) writeTo(data []byte) error {
+	err := m.checkConnect()
+	if err != nil {
+		return err
+	}
+	m.logger.command(data)
+	_, err = m.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	return m.writer.Flush()
+}
+
+func (m *Singleton) close() error {
+	if m.conn == nil {
+		return nil
+	}
+	return m.conn.Close()
 }
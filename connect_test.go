@@ -0,0 +1,138 @@
+package gibero
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serve accepts one connection and writes every chunk separately
+func serve(t *testing.T, chunks ...[]byte) *net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, chunk := range chunks {
+			conn.Write(chunk)
+			time.Sleep(5 * time.Millisecond)
+		}
+		buf := make([]byte, 64)
+		conn.Read(buf)
+	}()
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func header(msgType uint32, size uint32) []byte {
+	var data [16]byte
+	binary.BigEndian.PutUint32(data[0:4], msgType)
+	binary.BigEndian.PutUint32(data[4:8], size)
+	return data[:]
+}
+
+func TestReadMessagePartial(t *testing.T) {
+	assert := require.New(t)
+	writer := CreateWriter()
+	writer.WriteDBString("warning")
+	body := writer.Data()
+	head := header(75, uint32(len(body)))
+	addr := serve(t, head[:5], head[5:], body[:3], body[3:])
+	server := &Singleton{addr: addr}
+	assert.Nil(server.Connect(context.Background()))
+	defer server.close()
+	meta, reader, err := server.readMessage()
+	assert.Nil(err)
+	assert.Equal(uint32(75), meta.MsgType)
+	msg, err := handle(meta, reader)
+	assert.Nil(err)
+	assert.Equal("warning", msg.(*OkReply).warningMsg)
+}
+
+func TestReadMessageLimit(t *testing.T) {
+	assert := require.New(t)
+	addr := serve(t, header(75, MAX_MESSAGE_SIZE+1))
+	server := &Singleton{addr: addr}
+	assert.Nil(server.Connect(context.Background()))
+	defer server.close()
+	_, _, err := server.readMessage()
+	assert.NotNil(err)
+}
+
+func TestRowChunkTruncated(t *testing.T) {
+	assert := require.New(t)
+	reader := CreateReader(bytes.NewReader([]byte{0, 1}), nil, 0)
+	chunk := reader.reBuild(8)
+	assert.Equal(io.ErrUnexpectedEOF, reader.Err())
+	assert.Equal(uint32(0), chunk.Total)
+	reader = CreateReader(bytes.NewReader(nil), nil, 0)
+	reader.reBuild(MAX_MESSAGE_SIZE + 1)
+	assert.NotNil(reader.Err())
+}
+
+// silent accepts connections and never replies
+func silent(t *testing.T) *net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func TestConnectContext(t *testing.T) {
+	assert := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server := &Singleton{addr: silent(t)}
+	assert.ErrorIs(server.Connect(ctx), context.Canceled)
+}
+
+func TestDeadline(t *testing.T) {
+	assert := require.New(t)
+	dial := func() *TConn {
+		server := &Singleton{addr: silent(t)}
+		assert.Nil(server.Connect(context.Background()))
+		t.Cleanup(func() { server.close() })
+		return &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	}
+
+	conn := dial()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Equal(driver.ErrBadConn, conn.Ping(ctx))
+	assert.Less(time.Since(start), 5*time.Second)
+	assert.False(conn.IsValid())
+
+	conn = dial()
+	conn.tx = &TTx{conn: conn}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(driver.ErrBadConn, conn.ResetSession(ctx))
+	assert.False(conn.IsValid())
+
+	// a context already done leaves the connection usable
+	conn = dial()
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(context.Canceled, conn.Ping(ctx))
+	assert.True(conn.IsValid())
+}
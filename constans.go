@@ -32,4 +32,53 @@ var RTSIUP = &RsetType{4, 1004, 1008}
 var RTSSRD = &RsetType{5, 1005, 1008}
 var RTSSUP = &RsetType{6, 1005, 1007}
 
-var TB_VERBOSE = false
+// CONNECT_FLAG_SSL is set in the connect message flags by servers accepting TLS
+const CONNECT_FLAG_SSL uint32 = 0x10
+
+// MAX_MESSAGE_SIZE bounds the body and row chunk sizes accepted from the server
+const MAX_MESSAGE_SIZE uint32 = 64 << 20
+
+// MAX_PARAM_SIZE is the longest value a parameter can bind, its length is sent on 2 bytes
+const MAX_PARAM_SIZE = 0xffff
+
+// column and parameter data types as reported in TbColumnDesc.dataType
+const (
+	DT_NUMBER    = 1
+	DT_CHAR      = 2
+	DT_VARCHAR   = 3
+	DT_RAW       = 4
+	DT_DATE      = 5
+	DT_TIME      = 6
+	DT_TIMESTAMP = 7
+	DT_ITV_YTM   = 8
+	DT_ITV_DTS   = 9
+	DT_LONG      = 10
+	DT_LONGRAW   = 11
+	DT_BLOB      = 12
+	DT_CLOB      = 13
+	DT_RSET      = 14
+	DT_ROWID     = 15
+	DT_NCHAR     = 16
+	DT_NVARCHAR  = 17
+	DT_NCLOB     = 18
+	DT_BOOLEAN   = 25
+)
+
+// how bool parameters are bound, selected with the `bool` dsn parameter
+const (
+	// PL/SQL BOOLEAN inside anonymous blocks and calls, NUMBER 0/1 elsewhere
+	BOOL_AUTO = "auto"
+	// always NUMBER 0/1
+	BOOL_NUMBER = "number"
+	// always PL/SQL BOOLEAN
+	BOOL_PLSQL = "plsql"
+)
+
+// parameter modes sent with every bound parameter
+const (
+	PARAM_MODE_IN    = 1
+	PARAM_MODE_OUT   = 2
+	PARAM_MODE_INOUT = 3
+	// target of a RETURNING INTO clause, one value per affected row
+	PARAM_MODE_RETURN = 4
+)
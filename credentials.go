@@ -0,0 +1,99 @@
+package gibero
+
+import (
+	"context"
+	"errors"
+)
+
+// CredentialProvider supplies the user name and password of every new
+// physical connection, read for example from a file, the environment or
+// a local secrets agent instead of the dsn
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (username string, password string, err error)
+}
+
+// CredentialFunc adapts a function to CredentialProvider
+type CredentialFunc func(ctx context.Context) (string, string, error)
+
+func (f CredentialFunc) Credentials(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// PasswordChangeFunc is called when the server refused a login because the
+// password of username expired. It returns the new password to set.
+type PasswordChangeFunc func(ctx context.Context, username string) (string, error)
+
+// TBR_PASSWORD_EXPIRED is the error number of a login refused because the
+// password expired
+const TBR_PASSWORD_EXPIRED = 17006
+
+// IsPasswordExpired reports whether err refused a login because the password expired
+func IsPasswordExpired(err error) bool {
+	var ereply *EReply
+	return errors.As(err, &ereply) && ereply.Code() == TBR_PASSWORD_EXPIRED
+}
+
+// SetCredentialProvider makes every new connection ask provider for its
+// credentials, the user name and password of the dsn are ignored
+func (connector *TConnector) SetCredentialProvider(provider CredentialProvider) {
+	connector.credentials = provider
+}
+
+// SetPasswordChangeHandler registers the function choosing a new password
+// when a login fails with an expired password. Without a credential provider
+// the connector keeps using the new password for the next connections.
+func (connector *TConnector) SetPasswordChangeHandler(handler PasswordChangeFunc) {
+	connector.changePassword = handler
+}
+
+// connectDSN returns the dsn of a new connection filled with the current credentials
+func (connector *TConnector) connectDSN(ctx context.Context) (*TiberoDSN, error) {
+	connector.mu.Lock()
+	dsn := *connector.dsn
+	connector.mu.Unlock()
+	if connector.credentials != nil {
+		username, password, err := connector.credentials.Credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		dsn.username = username
+		dsn.password = password
+	}
+	return &dsn, nil
+}
+
+// passwordChanged keeps the password set during the login of a connection
+func (connector *TConnector) passwordChanged(dsn *TiberoDSN) {
+	if connector.credentials != nil {
+		return
+	}
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+	if connector.dsn.username == dsn.username {
+		connector.dsn.password = dsn.password
+	}
+}
+
+// renewPassword replaces the expired password during the login
+func (tibero *Tibero) renewPassword() (interface{}, error) {
+	info := tibero.dsn
+	password, err := tibero.changePassword(info.username)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, errors.New("empty new password")
+	}
+	cmd, err := ChangePasswordCmd(info.username, info.password, password, tibero.pem)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := tibero.write(cmd)
+	if err != nil {
+		return nil, err
+	}
+	tibero.logger.Info("password changed", "user", info.username)
+	info.password = password
+	tibero.passwordChanged = true
+	return msg, nil
+}
@@ -0,0 +1,103 @@
+package gibero
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// Cursor receives a REF CURSOR (SYS_REFCURSOR) returned through an OUT parameter
+//
+//	var cur gibero.Cursor
+//	conn.ExecContext(ctx, "BEGIN open_orders(?); END;", sql.Out{Dest: &cur})
+//	defer cur.Close()
+//
+// Rows are fetched on the connection which executed the call, so run the
+// call and read the cursor on the same sql.Conn.
+type Cursor struct {
+	tibero           *Tibero
+	csrId            uint32
+	colMeta          []*TbColumnDesc
+	resultSet        []*TbResultSet
+	resultIndex      int
+	isFetchCompleted bool
+	closed           bool
+}
+
+func (cur *Cursor) deserialize(reader *ByteReader) {
+	cur.csrId = reader.read32Big()
+	size := reader.count(reader.read32Big(), 24)
+	cur.colMeta = make([]*TbColumnDesc, size)
+	for a := 0; a < size; a++ {
+		tb := &TbColumnDesc{}
+		tb.deserialize(reader)
+		cur.colMeta[a] = tb
+	}
+}
+
+// Scan implements sql.Scanner so the cursor can be an OUT destination
+func (cur *Cursor) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*cur = Cursor{isFetchCompleted: true, closed: true}
+	case *Cursor:
+		*cur = *v
+	default:
+		return errors.New("cannot scan non cursor value into Cursor")
+	}
+	return nil
+}
+
+func (cur *Cursor) Columns() []string {
+	rt := make([]string, len(cur.colMeta))
+	for a := 0; a < len(cur.colMeta); a++ {
+		rt[a] = cur.colMeta[a].name
+	}
+	return rt
+}
+
+func (cur *Cursor) Next(dest []driver.Value) error {
+	if cur.closed {
+		return io.EOF
+	}
+	if cur.resultIndex >= len(cur.resultSet) && !cur.isFetchCompleted {
+		if cur.tibero == nil {
+			return errors.New("cursor is not bound to a connection")
+		}
+		rows, completed, err := cur.tibero.fetch(cur.csrId, cur.colMeta)
+		if err != nil {
+			return err
+		}
+		cur.resultSet = rows
+		cur.resultIndex = 0
+		cur.isFetchCompleted = completed
+		if completed {
+			cur.tibero.cursorClosed()
+		}
+	}
+	if cur.resultIndex >= len(cur.resultSet) {
+		return io.EOF
+	}
+	rset := cur.resultSet[cur.resultIndex]
+	cur.resultIndex++
+	for a := 0; a < len(rset.values) && a < len(dest); a++ {
+		dest[a] = rset.values[a]
+	}
+	return nil
+}
+
+// Close releases the cursor on the server
+func (cur *Cursor) Close() error {
+	if cur.closed {
+		return nil
+	}
+	cur.closed = true
+	if cur.tibero == nil {
+		return nil
+	}
+	if !cur.isFetchCompleted {
+		cur.isFetchCompleted = true
+		cur.tibero.cursorClosed()
+	}
+	return cur.tibero.closeCursor(cur.csrId)
+}
@@ -1,12 +1,18 @@
 package gibero
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 func DecryptWithPrivateKey(ciphertext []byte, priv *rsa.PrivateKey) ([]byte, error) {
@@ -42,18 +48,78 @@ func BytesToPrivateKey(raw []byte, password []byte) (*rsa.PrivateKey, error) {
 
 func BytesToPublicKey(raw []byte) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
 	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return nil, err
 	}
-	return publicKeyInterface.(*rsa.PublicKey), nil
+	key, ok := publicKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", publicKeyInterface)
+	}
+	return key, nil
 }
 
-func EncryptWithPublicKey(plainText []byte, publickey *rsa.PublicKey) []byte {
+func EncryptWithPublicKey(plainText []byte, publickey *rsa.PublicKey) ([]byte, error) {
 	sha1 := sha1.New()
-	cipherText, err := rsa.EncryptOAEP(sha1, rand.Reader, publickey, plainText, nil)
+	return rsa.EncryptOAEP(sha1, rand.Reader, publickey, plainText, nil)
+}
+
+// minimal size of the server key accepted in strict mode
+const minServerKeyBits = 2048
+
+const fingerprintPrefix = "sha256/"
+
+// PublicKeyFingerprint returns the pin of a PEM public key as used by the
+// `serverkey` dsn parameter: "sha256/" followed by the base64 encoded
+// SHA-256 digest of the DER encoded SubjectPublicKeyInfo
+func PublicKeyFingerprint(raw []byte) (string, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return "", errors.New("no PEM block found in public key")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return fingerprintPrefix + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+func checkFingerprint(pin string) error {
+	if !strings.HasPrefix(pin, fingerprintPrefix) {
+		return fmt.Errorf("invalid serverkey %q, expected sha256/<base64 digest>", pin)
+	}
+	sum, err := base64.StdEncoding.DecodeString(pin[len(fingerprintPrefix):])
+	if err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("invalid serverkey %q, expected sha256/<base64 digest>", pin)
+	}
+	return nil
+}
+
+// verifyServerKey validates the key received in the public key exchange.
+// Strict mode requires a single PUBLIC KEY block holding an RSA key of at
+// least 2048 bits, pin when not empty must match the key fingerprint.
+func verifyServerKey(raw []byte, strict bool, pin string) error {
+	key, err := BytesToPublicKey(raw)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("invalid server public key: %w", err)
+	}
+	if strict {
+		block, rest := pem.Decode(raw)
+		if block.Type != "PUBLIC KEY" || len(bytes.TrimSpace(rest)) > 0 {
+			return errors.New("invalid server public key: malformed PEM")
+		}
+		if key.N.BitLen() < minServerKeyBits {
+			return fmt.Errorf("invalid server public key: %d bits key", key.N.BitLen())
+		}
+	}
+	if pin != "" {
+		fingerprint, err := PublicKeyFingerprint(raw)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(pin)) != 1 {
+			return fmt.Errorf("server public key %s does not match the pinned key", fingerprint)
+		}
 	}
-	return cipherText
+	return nil
 }
@@ -2,6 +2,10 @@ package gibero
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -41,3 +45,174 @@ func (ts *TbTimestamp) toDate() *time.Time {
 	date := time.Date(ts.year(), m, ts.day(), ts.hour(), ts.minut(), ts.second(), ts.nano(), time.Local)
 	return &date
 }
+
+// Decimal is an exact decimal number such as "-1234.5678".
+// It is bound as NUMBER without going through float64.
+type Decimal string
+
+// NUMBER holds at most 20 bytes of base-100 digits, the first
+// significant digit is between 1e-130 and 1e125
+const (
+	NUMBER_MAX_DIGITS   = 40
+	NUMBER_MIN_EXPONENT = -130
+	NUMBER_MAX_EXPONENT = 125
+)
+
+// ErrNumberRange is returned for a Decimal that does not fit in NUMBER
+var ErrNumberRange = errors.New("decimal out of NUMBER range")
+
+// ParseDecimal validates str and returns it as a Decimal
+func ParseDecimal(str string) (Decimal, error) {
+	_, _, _, err := Decimal(str).parts()
+	if err != nil {
+		return "", err
+	}
+	return Decimal(str), nil
+}
+
+func (dec Decimal) String() string {
+	return string(dec)
+}
+
+// parts splits the value into significant digits, sign and
+// the decimal exponent of the first digit
+func (dec Decimal) parts() (mantissa []byte, negative bool, exponent int, err error) {
+	str := strings.TrimSpace(string(dec))
+	if strings.HasPrefix(str, "-") {
+		negative = true
+		str = str[1:]
+	} else if strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+	intPart := str
+	fracPart := ""
+	if index := strings.IndexByte(str, '.'); index >= 0 {
+		intPart = str[:index]
+		fracPart = str[index+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, false, 0, fmt.Errorf("invalid decimal %q", string(dec))
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return nil, false, 0, fmt.Errorf("invalid decimal %q", string(dec))
+		}
+	}
+	digits := strings.TrimLeft(intPart, "0")
+	exponent = len(digits) - 1
+	if digits == "" {
+		trimmed := strings.TrimLeft(fracPart, "0")
+		exponent = -(len(fracPart) - len(trimmed)) - 1
+		digits = trimmed
+	} else {
+		digits += fracPart
+	}
+	digits = strings.TrimRight(digits, "0")
+	if digits == "" {
+		return nil, false, 0, nil
+	}
+	if exponent < NUMBER_MIN_EXPONENT || exponent > NUMBER_MAX_EXPONENT {
+		return nil, false, 0, fmt.Errorf("%w: %q exponent %d", ErrNumberRange, string(dec), exponent)
+	}
+	// an even exponent is padded with a leading zero digit
+	size := len(digits)
+	if exponent%2 == 0 {
+		size++
+	}
+	if size > NUMBER_MAX_DIGITS {
+		return nil, false, 0, fmt.Errorf("%w: %q has %d significant digits", ErrNumberRange, string(dec), len(digits))
+	}
+	return []byte(digits), negative, exponent, nil
+}
+
+// Scan implements sql.Scanner for NUMBER columns
+func (dec *Decimal) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		*dec = Decimal(strconv.FormatInt(v, 10))
+	case float64:
+		*dec = Decimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		return dec.parse(v)
+	case []byte:
+		return dec.parse(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Decimal", src)
+	}
+	return nil
+}
+
+func (dec *Decimal) parse(str string) error {
+	val, err := ParseDecimal(str)
+	if err != nil {
+		return err
+	}
+	*dec = val
+	return nil
+}
+
+// IntervalYM is an INTERVAL YEAR TO MONTH value
+type IntervalYM struct {
+	Years  int32
+	Months int32
+}
+
+// IntervalDS is an INTERVAL DAY TO SECOND value
+type IntervalDS struct {
+	Days    int32
+	Hours   int32
+	Minutes int32
+	Seconds int32
+	Nanos   int32
+}
+
+// IntervalDSFromDuration splits d into days, hours, minutes, seconds and nanoseconds
+func IntervalDSFromDuration(d time.Duration) IntervalDS {
+	return IntervalDS{
+		Days:    int32(d / (24 * time.Hour)),
+		Hours:   int32(d % (24 * time.Hour) / time.Hour),
+		Minutes: int32(d % time.Hour / time.Minute),
+		Seconds: int32(d % time.Minute / time.Second),
+		Nanos:   int32(d % time.Second),
+	}
+}
+
+func (itv IntervalDS) Duration() time.Duration {
+	return time.Duration(itv.Days)*24*time.Hour +
+		time.Duration(itv.Hours)*time.Hour +
+		time.Duration(itv.Minutes)*time.Minute +
+		time.Duration(itv.Seconds)*time.Second +
+		time.Duration(itv.Nanos)
+}
+
+// wire layout: years(4, biased by 2^31) months(1, biased by 60)
+func fromIntervalYM(ret []byte, itv IntervalYM) {
+	binary.BigEndian.PutUint32(ret[0:4], uint32(itv.Years)+0x80000000)
+	ret[4] = byte(itv.Months + 60)
+}
+
+func toIntervalYM(data []byte) IntervalYM {
+	return IntervalYM{
+		Years:  int32(binary.BigEndian.Uint32(data[0:4]) - 0x80000000),
+		Months: int32(data[4]) - 60,
+	}
+}
+
+// wire layout: days(4, biased by 2^31) hour minute second(1, biased by 60) nanos(4, biased by 2^31)
+func fromIntervalDS(ret []byte, itv IntervalDS) {
+	binary.BigEndian.PutUint32(ret[0:4], uint32(itv.Days)+0x80000000)
+	ret[4] = byte(itv.Hours + 60)
+	ret[5] = byte(itv.Minutes + 60)
+	ret[6] = byte(itv.Seconds + 60)
+	binary.BigEndian.PutUint32(ret[7:11], uint32(itv.Nanos)+0x80000000)
+}
+
+func toIntervalDS(data []byte) IntervalDS {
+	return IntervalDS{
+		Days:    int32(binary.BigEndian.Uint32(data[0:4]) - 0x80000000),
+		Hours:   int32(data[4]) - 60,
+		Minutes: int32(data[5]) - 60,
+		Seconds: int32(data[6]) - 60,
+		Nanos:   int32(binary.BigEndian.Uint32(data[7:11]) - 0x80000000),
+	}
+}
@@ -1,6 +1,14 @@
 package gibero
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -16,3 +24,340 @@ func TestDsn(t *testing.T) {
 	assert.Equal(dsn.address, "127.0.0.1:1521", "address incorrect")
 	assert.Equal(dsn.dbname, "dbname", "dbname incorrect")
 }
+
+type testValuer struct{ v string }
+
+func (tv testValuer) Value() (driver.Value, error) {
+	return tv.v, nil
+}
+
+func TestCheckNamedValue(t *testing.T) {
+	assert := require.New(t)
+	conn := &TConn{}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: 12}
+		assert.Nil(conn.CheckNamedValue(nv))
+		assert.Equal(int64(12), nv.Value)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: uint64(math.MaxUint64)}
+		assert.Nil(conn.CheckNamedValue(nv))
+		assert.Equal(uint64(math.MaxUint64), nv.Value)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: json.RawMessage(`{"a":1}`)}
+		assert.Nil(conn.CheckNamedValue(nv))
+		assert.Equal(json.RawMessage(`{"a":1}`), nv.Value)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: testValuer{"abc"}}
+		assert.Nil(conn.CheckNamedValue(nv))
+		assert.Equal("abc", nv.Value)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: Decimal("12.50")}
+		assert.Nil(conn.CheckNamedValue(nv))
+		assert.Equal(Decimal("12.50"), nv.Value)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 1, Value: Decimal(strings.Repeat("9", 41))}
+		assert.ErrorIs(conn.CheckNamedValue(nv), ErrNumberRange)
+	}
+	{
+		nv := &driver.NamedValue{Ordinal: 3, Value: make(chan int)}
+		err := conn.CheckNamedValue(nv)
+		assert.EqualError(err, "unsupported type chan int for parameter 3")
+	}
+}
+
+func TestSetTransactionSQL(t *testing.T) {
+	assert := require.New(t)
+	cases := []struct {
+		opts   driver.TxOptions
+		expect string
+	}{
+		{driver.TxOptions{}, ""},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadCommitted)}, "SET TRANSACTION ISOLATION LEVEL READ COMMITTED"},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)}, "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"},
+		{driver.TxOptions{ReadOnly: true}, "SET TRANSACTION READ ONLY"},
+	}
+	for _, c := range cases {
+		stmt, err := setTransactionSQL(c.opts)
+		assert.Nil(err)
+		assert.Equal(c.expect, stmt)
+	}
+	_, err := setTransactionSQL(driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadUncommitted)})
+	assert.EqualError(err, "isolation level Read Uncommitted is not supported")
+	_, err = setTransactionSQL(driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadCommitted), ReadOnly: true})
+	assert.NotNil(err)
+}
+
+type testReply struct {
+	msgType uint32
+	body    []byte
+}
+
+// okServer answers with the queued replies, then with OkReply
+type okServer struct {
+	sent    [][]byte
+	replies []testReply
+	// returned by readMessage when set
+	err error
+}
+
+func (server *okServer) Connect(ctx context.Context) error { return nil }
+func (server *okServer) readMessage() (*Message, *ByteReader, error) {
+	if server.err != nil {
+		return nil, nil, server.err
+	}
+	if len(server.replies) > 0 {
+		reply := server.replies[0]
+		server.replies = server.replies[1:]
+		return &Message{MsgType: reply.msgType}, CreateReader(nil, reply.body, 0), nil
+	}
+	writer := CreateWriter()
+	writer.WriteDBString("")
+	return &Message{MsgType: 75}, CreateReader(nil, writer.Data(), 0), nil
+}
+func (server *okServer) writeTo(data []byte) error {
+	server.sent = append(server.sent, data)
+	return nil
+}
+func (server *okServer) flush()       {}
+func (server *okServer) close() error { return nil }
+
+func TestTransactionState(t *testing.T) {
+	assert := require.New(t)
+	server := &okServer{}
+	conn := &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	tx, err := conn.Begin()
+	assert.Nil(err)
+	assert.Equal(uint32(0), conn.autoComit)
+	_, err = conn.Begin()
+	assert.Equal(errTxInProgress, err)
+	stmt, _ := conn.Prepare("update t set a = 1")
+	assert.Nil(tx.Commit())
+	assert.Equal(uint32(1), conn.autoComit)
+	assert.Equal(sql.ErrTxDone, tx.Commit())
+	_, err = stmt.(*PrepareStatement).exec()
+	assert.Equal(sql.ErrTxDone, err)
+
+	tx, err = conn.Begin()
+	assert.Nil(err)
+	assert.Nil(tx.Rollback())
+	assert.Equal(uint32(1), conn.autoComit)
+	stmt, _ = conn.Prepare("update t set a = 1")
+	_, err = stmt.(*PrepareStatement).exec()
+	assert.Nil(err)
+	assert.Equal(uint32(1), stmt.(*PrepareStatement).autoComit)
+}
+
+func TestSavepoint(t *testing.T) {
+	assert := require.New(t)
+	server := &okServer{}
+	conn := &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	assert.Equal(errNoTransaction, conn.Savepoint("a"))
+	tx, _ := conn.Begin()
+	assert.Nil(conn.Savepoint("a"))
+	assert.Nil(conn.Savepoint("b"))
+	assert.Nil(conn.Savepoint("c"))
+	assert.NotNil(conn.Savepoint("x; drop table t"))
+	assert.Nil(conn.RollbackTo("b"))
+	assert.Equal(RollbackCMD("B"), server.sent[len(server.sent)-1])
+	assert.Equal([]string{"A", "B"}, conn.savepoints)
+	assert.NotNil(conn.RollbackTo("c"))
+	assert.Nil(conn.ReleaseSavepoint("a"))
+	assert.NotNil(conn.RollbackTo("b"))
+	assert.Nil(tx.Commit())
+	assert.Nil(conn.savepoints)
+}
+
+func TestSessionReset(t *testing.T) {
+	assert := require.New(t)
+	server := &okServer{}
+	conn := &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	assert.Nil(conn.Ping(context.Background()))
+	tx, _ := conn.Begin()
+	assert.Nil(conn.ResetSession(context.Background()))
+	assert.Equal(RollbackCMD(""), server.sent[len(server.sent)-1])
+	assert.Equal(uint32(1), conn.autoComit)
+	assert.Equal(sql.ErrTxDone, tx.Commit())
+	assert.True(conn.IsValid())
+
+	server.err = io.ErrUnexpectedEOF
+	assert.Equal(driver.ErrBadConn, conn.Ping(context.Background()))
+	assert.False(conn.IsValid())
+	assert.Equal(driver.ErrBadConn, conn.ResetSession(context.Background()))
+}
+
+func TestReadReply(t *testing.T) {
+	assert := require.New(t)
+	notice := CreateWriter()
+	notice.WriteBig32(1)
+	notice.WriteDBString("compiled with warnings")
+	ereply := CreateWriter()
+	ereply.WriteBig32(0)
+	ereply.WriteBig32(0)
+	ereply.WriteBig32(0)
+	server := &okServer{replies: []testReply{
+		{msgType: 77, body: notice.Data()},
+		{msgType: 4242},
+		{msgType: 76, body: ereply.Data()},
+	}}
+	tibero := &Tibero{DBServer: server}
+	var notices []string
+	tibero.onWarning = func(warning Warning) {
+		notices = append(notices, warning.Message)
+	}
+	_, err := tibero.write(CommitCMD())
+	assert.Equal(&UnexpectedMessageError{MsgType: 4242}, err)
+	assert.Equal([]string{"compiled with warnings"}, notices)
+	// the reply queued behind the unknown message is never taken for the
+	// reply of the next command, the connection is discarded instead
+	conn := &TConn{tibero: tibero}
+	assert.False(conn.IsValid())
+	_, err = tibero.write(CommitCMD())
+	assert.Equal(driver.ErrBadConn, err)
+	assert.Len(server.replies, 1)
+	assert.Len(server.sent, 1)
+
+	tibero = &Tibero{DBServer: &okServer{replies: []testReply{{msgType: 76, body: ereply.Data()}}}}
+	_, err = tibero.write(CommitCMD())
+	_, ok := err.(*EReply)
+	assert.True(ok)
+	msg, err := tibero.write(CommitCMD())
+	assert.Nil(err)
+	assert.IsType(&OkReply{}, msg)
+	assert.EqualError(unexpectedReply(msg), "unexpected message type 75 (tsn 0)")
+}
+
+func TestRegisterMessage(t *testing.T) {
+	assert := require.New(t)
+	var bodies []string
+	assert.Nil(RegisterMessage(4343, func(msgType uint32, body []byte) {
+		bodies = append(bodies, fmt.Sprintf("%d %x", msgType, body))
+	}))
+	assert.NotNil(RegisterMessage(4343, func(uint32, []byte) {}))
+	assert.EqualError(RegisterMessage(76, func(uint32, []byte) {}), "message type 76 is already registered")
+	server := &okServer{replies: []testReply{{msgType: 4343, body: []byte{0xca, 0xfe}}}}
+	tibero := &Tibero{DBServer: server}
+	msg, err := tibero.write(CommitCMD())
+	assert.Nil(err)
+	assert.IsType(&OkReply{}, msg)
+	assert.Equal([]string{"4343 cafe"}, bodies)
+}
+
+func TestWarnings(t *testing.T) {
+	assert := require.New(t)
+	ok := CreateWriter()
+	ok.WriteDBString("Warning: procedure created with compilation errors")
+	notice := CreateWriter()
+	notice.WriteBig32(15163)
+	notice.WriteDBString("unused variable")
+	server := &okServer{replies: []testReply{{msgType: 77, body: notice.Data()}, {msgType: 75, body: ok.Data()}}}
+	connector := &TConnector{}
+	var handled []Warning
+	connector.SetWarningHandler(func(warning Warning) {
+		handled = append(handled, warning)
+	})
+	conn := &TConn{connector: connector, tibero: &Tibero{DBServer: server}, autoComit: 1}
+	conn.tibero.onWarning = conn.addWarning
+	stmt, _ := conn.Prepare("CREATE OR REPLACE PROCEDURE p IS BEGIN NULL; END;")
+	result, err := stmt.Exec(nil)
+	assert.Nil(err)
+	count, _ := result.RowsAffected()
+	assert.Equal(int64(0), count)
+	warnings := conn.Warnings()
+	assert.Equal([]Warning{
+		{Code: 15163, Message: "unused variable"},
+		{Message: "Warning: procedure created with compilation errors"},
+	}, warnings)
+	assert.Equal(warnings, handled)
+	assert.Equal("TBR-15163: unused variable", warnings[0].String())
+	assert.Nil(conn.Warnings())
+}
+
+func TestExecuteCount(t *testing.T) {
+	assert := require.New(t)
+	reply := &TbMsgExecuteCountReply{cntHigh: 1, cntLow: 5}
+	count, err := reply.RowsAffected()
+	assert.Nil(err)
+	assert.Equal(int64(1<<32+5), count)
+	_, err = reply.LastInsertId()
+	assert.Equal(ErrLastInsertIdNotSupported, err)
+}
+
+type logEntry struct {
+	level string
+	msg   string
+	kv    []any
+}
+
+type testLogger struct{ entries []logEntry }
+
+func (l *testLogger) Debug(msg string, kv ...any) {
+	l.entries = append(l.entries, logEntry{"debug", msg, kv})
+}
+func (l *testLogger) Info(msg string, kv ...any) {
+	l.entries = append(l.entries, logEntry{"info", msg, kv})
+}
+func (l *testLogger) Warn(msg string, kv ...any) {
+	l.entries = append(l.entries, logEntry{"warn", msg, kv})
+}
+func (l *testLogger) Error(msg string, kv ...any) {
+	l.entries = append(l.entries, logEntry{"error", msg, kv})
+}
+
+func TestLogger(t *testing.T) {
+	assert := require.New(t)
+	notice := CreateWriter()
+	notice.WriteBig32(3)
+	notice.WriteDBString("compiled with warnings")
+	server := &okServer{replies: []testReply{{msgType: 77, body: notice.Data()}}}
+	tibero := &Tibero{DBServer: server}
+	logger := &testLogger{}
+	tibero.setLogger(logger, nextConnID())
+	ps := tibero.createPrepareStatement("update t set a = 1", 1)
+	_, err := ps.doExec()
+	assert.Nil(err)
+	assert.Len(logger.entries, 3)
+	assert.Equal("prepare", logger.entries[0].msg)
+	assert.Equal(logEntry{"debug", "execute", []any{"conn", tibero.logger.attrs[1], "sql", "update t set a = 1", "params", 0, "autocommit", uint32(1)}}, logger.entries[1])
+	assert.Equal(logEntry{"warn", "server warning", []any{"conn", tibero.logger.attrs[1], "code", 3, "message", "compiled with warnings"}}, logger.entries[2])
+
+	server.err = io.ErrUnexpectedEOF
+	_, err = tibero.commit()
+	assert.Equal(io.ErrUnexpectedEOF, err)
+	assert.Equal("error", logger.entries[len(logger.entries)-1].level)
+
+	tibero = &Tibero{DBServer: &okServer{}}
+	_, err = tibero.commit()
+	assert.Nil(err)
+}
+
+func TestPacketDump(t *testing.T) {
+	assert := require.New(t)
+	logger := &testLogger{}
+	log := connLogger{logger: logger}
+	commit := CommitCMD()
+	auth := append(header(AUTH.code(), 0), "secret"...)
+	log.command(commit)
+	log.dump = true
+	log.command(commit)
+	log.command(auth)
+	log.packet("receive", []byte{1, 2}, "msgType", 75)
+	hexdump := func(entry logEntry) bool {
+		for a := 0; a < len(entry.kv); a += 2 {
+			if entry.kv[a] == "hex" {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Len(logger.entries, 4)
+	assert.Equal([]any{"cmd", Tibero_CMD_CODE(23), "size", 16}, logger.entries[0].kv)
+	assert.True(hexdump(logger.entries[1]))
+	assert.False(hexdump(logger.entries[2]))
+	assert.Equal(AUTH, logger.entries[2].kv[1])
+	assert.Equal([]any{"msgType", 75, "size", 2, "hex", "0102"}, logger.entries[3].kv)
+}
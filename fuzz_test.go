@@ -0,0 +1,299 @@
+package gibero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// capturedReplies returns the replies of testdata/session.trace as seeds of
+// the fuzz targets. The session was recorded against tiberotest, not a real
+// server, so it only holds the frames tiberotest produces; builtReplies
+// adds hand-built replies of the other messages.
+func capturedReplies(tb testing.TB) [][]byte {
+	file, err := os.Open("testdata/session.trace")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := NewTraceReader(file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var replies [][]byte
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if record.Direction == TraceReceived {
+			replies = append(replies, record.Data)
+		}
+	}
+}
+
+// builtReplies returns hand-built replies of the messages a recorded
+// session does not hold, as seeds of the fuzz targets
+func builtReplies() [][]byte {
+	message := func(msgType uint32, body []byte) []byte {
+		return append(header(msgType, uint32(len(body))), body...)
+	}
+	psm := CreateWriter()
+	psm.WriteBig64(0)
+	psm.WriteBig64(1)
+	psm.WriteBig32(2)
+	psm.WriteBig32(DT_NUMBER)
+	psm.WriteDBBytes(EncodeInt64(42))
+	psm.WriteBig32(DT_VARCHAR)
+	psm.WriteDBBytes([]byte("out"))
+	batch := CreateWriter()
+	batch.WriteBig64(0)
+	batch.WriteBig32(2)
+	batch.WriteBig64(1)
+	batch.WriteBig64(0)
+	batch.WriteBig32(1)
+	batch.WriteBig32(1)
+	batch.WriteBig32(1)
+	batch.WriteDBString("23000")
+	batch.WriteDBString("unique constraint violated")
+	xa := CreateWriter()
+	xa.WriteBig32(uint32(XA_RDONLY))
+	xids := CreateWriter()
+	xids.WriteBig32(1)
+	(&Xid{FormatID: 1, GlobalTransactionID: []byte("gtrid"), BranchQualifier: []byte("bqual")}).serialize(xids)
+	notice := CreateWriter()
+	notice.WriteBig32(1)
+	notice.WriteDBString("compiled with warnings")
+	noError := CreateWriter()
+	noError.WriteBig32(0)
+	noError.WriteBig32(0)
+	noError.WriteBig32(0)
+	return [][]byte{
+		message(14, psm.Data()),
+		message(16, batch.Data()),
+		message(17, returningReply(2, [][]byte{EncodeInt64(1), EncodeInt64(2)})),
+		message(68, xa.Data()),
+		message(69, xids.Data()),
+		message(77, notice.Data()),
+		message(76, noError.Data()),
+		message(76, errorReply(1234, "resource busy")),
+	}
+}
+
+// decodeReply decodes a whole message the way readReply does
+func decodeReply(data []byte) (interface{}, *ByteReader, error) {
+	meta, err := parseHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	end := 16 + uint64(meta.MsgBodySize)
+	if end > uint64(len(data)) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	reader := CreateReader(bytes.NewReader(data[end:]), data[16:end], 0)
+	msg, err := handle(meta, reader)
+	return msg, reader, err
+}
+
+func FuzzHeader(f *testing.F) {
+	for _, reply := range append(capturedReplies(f), builtReplies()...) {
+		f.Add(reply)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, reader, err := decodeReply(data)
+		if err != nil {
+			return
+		}
+		if reader.Err() == nil && msg == nil {
+			t.Fatal("no message decoded")
+		}
+		(&TraceRecord{Direction: TraceReceived, Data: data}).Describe()
+	})
+}
+
+// eReplyBody builds an error reply body holding up to 3 of the size
+// exceptions it announces. The exception records are 936 bytes of mostly
+// padding, so FuzzEReply fuzzes their fields rather than the raw bytes to
+// keep its inputs small enough to be minimized quickly.
+func eReplyBody(flag uint32, exists uint32, size uint32, vendorCode uint32, sqlState string, reason string) []byte {
+	writer := CreateWriter()
+	writer.WriteBig32(flag)
+	writer.WriteBig32(exists)
+	writer.WriteBig64(0)
+	writer.WriteBig32(size)
+	writer.WriteBig32(0)
+	body := writer.Data()
+	for a := uint32(0); a < size && a < 3; a++ {
+		record := make([]byte, 12+4+9+6+712+5+8+96+84)
+		binary.BigEndian.PutUint32(record[12:16], vendorCode)
+		copy(record[25:31], sqlState)
+		copy(record[31:743], reason)
+		body = append(body, record...)
+	}
+	return body
+}
+
+func FuzzEReply(f *testing.F) {
+	for _, reply := range append(capturedReplies(f), builtReplies()...) {
+		if binary.BigEndian.Uint32(reply) != 76 {
+			continue
+		}
+		msg, _, err := decodeReply(reply)
+		if err != nil {
+			f.Fatal(err)
+		}
+		ereply := msg.(*EReply)
+		if ereply.noError {
+			f.Add(ereply.flag, uint32(0), uint32(0), uint32(0), "", "", uint32(len(reply)-16))
+			continue
+		}
+		for _, e := range ereply.exceptions {
+			f.Add(ereply.flag, uint32(1), uint32(len(ereply.exceptions)), e.vendorCode, e.sqlState, e.reason, uint32(len(reply)-16))
+		}
+	}
+	f.Fuzz(func(t *testing.T, flag uint32, exists uint32, size uint32, vendorCode uint32, sqlState string, reason string, cut uint32) {
+		if len(sqlState) > 6 || len(reason) > 712 {
+			// longer values are cut by eReplyBody, they reach no new code
+			return
+		}
+		body := eReplyBody(flag, exists, size, vendorCode, sqlState, reason)
+		if cut < uint32(len(body)) {
+			body = body[:cut]
+		}
+		reader := CreateReader(nil, body, 0)
+		msg, _ := handle(&Message{MsgType: 76}, reader)
+		if reader.Err() != nil {
+			if !errors.Is(reader.Err(), ErrMalformedMessage) {
+				t.Fatalf("unexpected error %v", reader.Err())
+			}
+			return
+		}
+		ereply := msg.(*EReply)
+		if ereply.Error() == "" {
+			t.Fatal("empty error message")
+		}
+		if len(ereply.exceptions) > 0 && ereply.exceptions[0].vendorCode != vendorCode {
+			t.Fatalf("vendor code %d decoded for %d", ereply.exceptions[0].vendorCode, vendorCode)
+		}
+	})
+}
+
+var fuzzColumnTypes = []uint32{DT_NUMBER, DT_CHAR, DT_VARCHAR, DT_RAW, DT_DATE, DT_TIMESTAMP,
+	DT_ROWID, DT_RSET, DT_ITV_YTM, DT_ITV_DTS, DT_BOOLEAN, DT_NCHAR, DT_NVARCHAR, DT_BLOB}
+
+func FuzzReadRow(f *testing.F) {
+	var colMeta []*TbColumnDesc
+	for _, reply := range capturedReplies(f) {
+		msg, _, _ := decodeReply(reply)
+		switch m := msg.(type) {
+		case *TbMsgExecutePrefetchReply:
+			colMeta = m.colMeta
+			f.Add(m.rowCnt, columnTypes(colMeta), reply[len(reply)-int(m.rowChunkSize):])
+		case *TbMsgFetchReply:
+			f.Add(m.rowCnt, columnTypes(colMeta), m.rowChunk)
+		}
+	}
+	// many columns and a short chunk announcing many rows
+	f.Add(uint32(4999), make([]byte, 5000), make([]byte, 15000))
+	f.Fuzz(func(t *testing.T, rowCnt uint32, types []byte, chunk []byte) {
+		colMeta := make([]*TbColumnDesc, len(types))
+		for a, dtype := range types {
+			colMeta[a] = &TbColumnDesc{dataType: fuzzColumnTypes[int(dtype)%len(fuzzColumnTypes)]}
+		}
+		reader := CreateReader(nil, chunk, 0)
+		reader.moveCursor(1)
+		rows := readRows(reader, rowCnt, colMeta)
+		if reader.Err() != nil {
+			if !errors.Is(reader.Err(), ErrMalformedMessage) {
+				t.Fatalf("unexpected error %v", reader.Err())
+			}
+			return
+		}
+		if len(rows) != int(rowCnt) {
+			t.Fatalf("%d rows read for %d", len(rows), rowCnt)
+		}
+		for _, row := range rows {
+			if len(row.values) != len(colMeta) {
+				t.Fatalf("%d values read for %d columns", len(row.values), len(colMeta))
+			}
+		}
+	})
+}
+
+func columnTypes(colMeta []*TbColumnDesc) []byte {
+	types := make([]byte, len(colMeta))
+	for a, desc := range colMeta {
+		for index, dtype := range fuzzColumnTypes {
+			if dtype == desc.dataType {
+				types[a] = byte(index)
+			}
+		}
+	}
+	return types
+}
+
+func FuzzFromNumber(f *testing.F) {
+	for _, val := range []int64{0, 1, -1, 100, -12345, 1 << 62, -(1 << 62)} {
+		f.Add(EncodeInt64(val))
+	}
+	for _, val := range []float64{0.5, -12.5, 1e20, -1e-20} {
+		num, _ := EncodeFloat(val, 64)
+		f.Add(num)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _, _, _, err := FromNumber(data)
+		if err != nil && len(data) > 0 {
+			t.Fatalf("unexpected error %v", err)
+		}
+		DecodeNumber(data)
+		DecodeDouble(data)
+		DecodeInt(data)
+	})
+}
+
+func TestRowCountBound(t *testing.T) {
+	colMeta := make([]*TbColumnDesc, 5000)
+	for a := range colMeta {
+		colMeta[a] = &TbColumnDesc{dataType: DT_NUMBER}
+	}
+	reader := CreateReader(nil, make([]byte, 15000), 0)
+	rows := readRows(reader, 4999, colMeta)
+	if !errors.Is(reader.Err(), ErrMalformedMessage) || len(rows) != 0 {
+		t.Fatalf("%d rows read, error %v", len(rows), reader.Err())
+	}
+	// a row of NULL columns takes 3 bytes and one byte a column
+	reader = CreateReader(nil, make([]byte, 2*(3+5000)), 0)
+	rows = readRows(reader, 2, colMeta)
+	if reader.Err() != nil || len(rows) != 2 {
+		t.Fatalf("%d rows read, error %v", len(rows), reader.Err())
+	}
+}
+
+func TestTruncatedReplies(t *testing.T) {
+	for _, reply := range builtReplies() {
+		_, reader, err := decodeReply(reply)
+		if err != nil || reader.Err() != nil {
+			t.Fatalf("seed of type %d does not decode: %v %v", binary.BigEndian.Uint32(reply), err, reader.Err())
+		}
+	}
+	for _, reply := range append(capturedReplies(t), builtReplies()...) {
+		for size := 16; size < len(reply); size++ {
+			// the body is cut and announced as such, so no chunk follows it
+			data := append([]byte(nil), reply[:size]...)
+			binary.BigEndian.PutUint32(data[4:8], uint32(size-16))
+			_, reader, err := decodeReply(data)
+			if err != nil || reader.Err() == nil {
+				continue
+			}
+			if !errors.Is(reader.Err(), ErrMalformedMessage) && reader.Err() != io.EOF {
+				t.Fatalf("unexpected error %v", reader.Err())
+			}
+		}
+	}
+}
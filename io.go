@@ -2,6 +2,8 @@ package gibero
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
@@ -11,81 +13,109 @@ type ByteReader struct {
 	Data   []byte
 	Total  uint32
 	reader io.Reader
+	// first error met reading beyond Data from reader
+	err error
 }
 
+func (reader *ByteReader) Err() error {
+	return reader.err
+}
+
+// ErrMalformedMessage is returned for a message which does not hold
+// what its lengths and counts announce
+var ErrMalformedMessage = errors.New("malformed message")
+
+// read returns the next size bytes of Data. Past the end it keeps an
+// error in Err, moves to the end and returns nil.
 func (reader *ByteReader) read(size uint32) []byte {
+	if reader.err != nil {
+		return nil
+	}
 	start := reader.Cur
-	last := start + size
-	if last > reader.Total {
-		panic("outofIndex")
+	if uint64(start)+uint64(size) > uint64(reader.Total) {
+		reader.err = fmt.Errorf("%w: %d bytes needed at offset %d of %d", ErrMalformedMessage, size, start, reader.Total)
+		reader.Cur = reader.Total
+		return nil
 	}
 	reader.Cur += size
-	return reader.Data[start:last]
+	return reader.Data[start:reader.Cur]
+}
+
+// count checks that size items of at least itemSize bytes each can
+// follow, so that a corrupted count never allocates more than the message
+func (reader *ByteReader) count(size uint32, itemSize uint32) int {
+	if reader.err != nil {
+		return 0
+	}
+	if uint64(size)*uint64(itemSize) > uint64(reader.Total-reader.Cur) {
+		reader.err = fmt.Errorf("%w: %d items announced with %d bytes left", ErrMalformedMessage, size, reader.Total-reader.Cur)
+		reader.Cur = reader.Total
+		return 0
+	}
+	return int(size)
+}
+
+// readPpid reads the 8 bytes id heading the execute replies
+func (reader *ByteReader) readPpid() *[8]byte {
+	var ppid [8]byte
+	copy(ppid[:], reader.read(8))
+	return &ppid
 }
+
 func (reader *ByteReader) read32Big() uint32 {
-	start := reader.Cur
-	last := start + 4
-	if last > reader.Total {
-		panic("outofIndex")
+	bt := reader.read(4)
+	if bt == nil {
+		return 0
 	}
-	reader.Cur += 4
-	return binary.BigEndian.Uint32(reader.Data[start:last])
+	return binary.BigEndian.Uint32(bt)
 }
 
 func (reader *ByteReader) read16Big() uint16 {
-	start := reader.Cur
-	last := start + 2
-	if last > reader.Total {
-		panic("outofIndex")
+	bt := reader.read(2)
+	if bt == nil {
+		return 0
 	}
-	reader.Cur += 2
-	return binary.BigEndian.Uint16(reader.Data[start:last])
+	return binary.BigEndian.Uint16(bt)
 }
 
 func (reader *ByteReader) readByte() uint8 {
-	start := reader.Cur
-	last := start + 1
-	if last > reader.Total {
-		panic("outofIndex")
+	bt := reader.read(1)
+	if bt == nil {
+		return 0
 	}
-	reader.Cur += 1
-	return reader.Data[start]
+	return bt[0]
 }
 
 func (reader *ByteReader) read64Big() uint64 {
-	start := reader.Cur
-	last := start + 8
-	if last > reader.Total {
-		panic("outofIndex")
+	bt := reader.read(8)
+	if bt == nil {
+		return 0
 	}
-	reader.Cur += 8
-	return binary.BigEndian.Uint64(reader.Data[start:last])
+	return binary.BigEndian.Uint64(bt)
 }
 
+// moveCursor skips offset bytes, stopping at the end of Data as the
+// padding of the last field may be left out
 func (reader *ByteReader) moveCursor(offset uint32) {
+	if uint64(reader.Cur)+uint64(offset) > uint64(reader.Total) {
+		reader.Cur = reader.Total
+		return
+	}
 	reader.Cur += offset
 }
 func (reader *ByteReader) read32String(len uint32) string {
-	start := reader.Cur
-	reader.Cur += len
-	return string(reader.Data[start : start+len])
+	return string(reader.read(len))
 }
 
 func (reader *ByteReader) readDBByte32(padding bool) *DBByte32 {
 	size := reader.read32Big()
-	pad := size % 4
-	leng := size
-	if pad > 0 {
-		leng = size + 4 - pad
+	data := reader.read(size)
+	reader.moveCursor(pad(size) % 4)
+	bt := DBByte32{}
+	if data != nil {
+		bt = DecodePadString(size, data)
 	}
-	start := reader.Cur
-	last := start + leng
-	if last > reader.Total {
-		panic("outofIndex")
-	}
-	reader.Cur += leng
-	bt := DecodePadString(size, reader.Data[start:last])
-	return (*DBByte32)(&bt)
+	return &bt
 }
 func (reader *ByteReader) ReadDBString() string {
 	leng := reader.read32Big()
@@ -95,9 +125,43 @@ func (reader *ByteReader) ReadDBString() string {
 	return str
 }
 
+// readDBValue reads a value written the way WriteDBBytes writes it
+// and decodes it as dtype
+func (reader *ByteReader) readDBValue(dtype uint32) interface{} {
+	size := uint32(reader.readByte())
+	head := uint32(1)
+	if size > 250 {
+		size = uint32(reader.read16Big())
+		head = 3
+	}
+	var val interface{}
+	if size > 0 {
+		val = des(reader, dtype, size)
+	}
+	reader.moveCursor(pad(size + head))
+	return val
+}
+
+// reBuild reads size more bytes which follow the message body on the stream.
+// A failure is kept in Err and an empty reader is returned.
 func (reader *ByteReader) reBuild(size uint32) *ByteReader {
+	if reader.err != nil {
+		return CreateReader(nil, nil, 0)
+	}
+	if reader.reader == nil {
+		reader.err = errors.New("no stream to read the row chunk from")
+		return CreateReader(nil, nil, 0)
+	}
+	if size > MAX_MESSAGE_SIZE {
+		reader.err = fmt.Errorf("row chunk of %d bytes is more than the %d bytes limit", size, MAX_MESSAGE_SIZE)
+		return CreateReader(nil, nil, 0)
+	}
 	data := make([]byte, size)
-	reader.reader.Read(data)
+	_, err := io.ReadFull(reader.reader, data)
+	if err != nil {
+		reader.err = err
+		return CreateReader(nil, nil, 0)
+	}
 	return CreateReader(reader.reader, data, 0)
 }
 
@@ -107,6 +171,8 @@ type ByteWriter struct {
 	cur uint32
 }
 
+var _ io.ByteWriter = (*ByteWriter)(nil)
+
 func (writer *ByteWriter) Size() uint32 {
 	return writer.n
 }
@@ -126,10 +192,14 @@ func (writer *ByteWriter) buffer(length uint32) []byte {
 func (writer *ByteWriter) Data() []byte {
 	return writer.buf[0:writer.cur]
 }
-func (writer *ByteWriter) WriteByte(val byte) {
+
+// WriteByte implements io.ByteWriter, go vet requires the error result
+// for a method of that name. It never fails.
+func (writer *ByteWriter) WriteByte(val byte) error {
 	var ll uint32 = 1
 	writer.buffer(ll)[0] = val
 	writer.cur = writer.cur + ll
+	return nil
 }
 func (writer *ByteWriter) WriteBig32(val uint32) {
 	var ll uint32 = 4
@@ -168,16 +238,31 @@ func (writer *ByteWriter) WriteDBString(val string) {
 	writer.putPad(pad(strLen))
 }
 func (writer *ByteWriter) WriteDBMinLenString(val string) {
-	data := []byte(val)
-	strLen := byte(len(val))
-	writer.WriteByte(strLen)
-	copy(writer.buffer(uint32(strLen)), data)
-	writer.cur = writer.cur + uint32(strLen)
-	writer.putPad(pad(uint32(strLen) + 1))
+	writer.WriteDBBytes([]byte(val))
 }
 
-func (writer *ByteWriter) WriteDBInteger(val int64) {
-	data := EncodeInt64(val)
+// WriteDBBytes writes a value with the same length prefix the server uses
+// for row data: one byte up to 250, otherwise 0xfe followed by 2 bytes.
+// Values longer than MAX_PARAM_SIZE are rejected by setting beforehand.
+func (writer *ByteWriter) WriteDBBytes(data []byte) {
+	size := uint32(len(data))
+	head := uint32(1)
+	if size <= 250 {
+		writer.WriteByte(byte(size))
+	} else {
+		head = 3
+		writer.WriteByte(0xfe)
+		binary.BigEndian.PutUint16(writer.buffer(2), uint16(size))
+		writer.cur = writer.cur + 2
+	}
+	copy(writer.buffer(size), data)
+	writer.cur = writer.cur + size
+	writer.putPad(pad(size + head))
+}
+
+// WriteDBNumber writes an encoded NUMBER parameter, its length is sent
+// twice: the size of the value including the inner length byte, then the number
+func (writer *ByteWriter) WriteDBNumber(data []byte) {
 	strLen := byte(len(data))
 	writer.WriteByte(strLen + 1)
 	writer.WriteByte(strLen)
@@ -185,14 +270,13 @@ func (writer *ByteWriter) WriteDBInteger(val int64) {
 	writer.cur = writer.cur + uint32(strLen)
 	writer.putPad(pad(uint32(strLen) + 2))
 }
+
+func (writer *ByteWriter) WriteDBInteger(val int64) {
+	writer.WriteDBNumber(EncodeInt64(val))
+}
 func (writer *ByteWriter) WriteDBFloat(val float64, bitSize int) {
 	data, _ := EncodeFloat(val, bitSize)
-	strLen := byte(len(data))
-	writer.WriteByte(strLen + 1)
-	writer.WriteByte(strLen)
-	copy(writer.buffer(uint32(strLen)), data)
-	writer.cur = writer.cur + uint32(strLen)
-	writer.putPad(pad(uint32(strLen) + 2))
+	writer.WriteDBNumber(data)
 }
 func (writer *ByteWriter) WriteTimestamp(ti *time.Time) {
 	var size byte = 12
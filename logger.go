@@ -0,0 +1,104 @@
+package gibero
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sync/atomic"
+)
+
+// Logger receives the diagnostics of the driver. The methods match those of
+// *slog.Logger so one can be passed as is, kv holds alternating keys and values.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// SetLogger routes the diagnostics of every connection to logger,
+// the driver logs nothing by default
+func (connector *TConnector) SetLogger(logger Logger) {
+	connector.logger = logger
+}
+
+// SetPacketDump adds the hex dump of the packets to their debug entries.
+// The dumps hold the bound values, the login commands carrying the
+// password are never dumped.
+func (connector *TConnector) SetPacketDump(enabled bool) {
+	connector.packetDump = enabled
+}
+
+// sequence numbering the physical connections in the logs
+var connSeq uint64
+
+func nextConnID() uint64 {
+	return atomic.AddUint64(&connSeq, 1)
+}
+
+// connLogger adds the attributes of a connection to every entry,
+// the zero value logs nothing
+type connLogger struct {
+	logger Logger
+	attrs  []any
+	// adds the hex dump to the packet entries
+	dump bool
+}
+
+func (l connLogger) with(kv ...any) connLogger {
+	return connLogger{logger: l.logger, attrs: l.join(kv), dump: l.dump}
+}
+
+func (l connLogger) join(kv []any) []any {
+	all := make([]any, 0, len(l.attrs)+len(kv))
+	return append(append(all, l.attrs...), kv...)
+}
+
+func (l connLogger) Debug(msg string, kv ...any) {
+	if l.logger != nil {
+		l.logger.Debug(msg, l.join(kv)...)
+	}
+}
+
+func (l connLogger) Info(msg string, kv ...any) {
+	if l.logger != nil {
+		l.logger.Info(msg, l.join(kv)...)
+	}
+}
+
+func (l connLogger) Warn(msg string, kv ...any) {
+	if l.logger != nil {
+		l.logger.Warn(msg, l.join(kv)...)
+	}
+}
+
+func (l connLogger) Error(msg string, kv ...any) {
+	if l.logger != nil {
+		l.logger.Error(msg, l.join(kv)...)
+	}
+}
+
+// packet logs the size of the bytes sent or received at debug level, and
+// their hex dump when enabled
+func (l connLogger) packet(msg string, data []byte, kv ...any) {
+	if l.logger == nil {
+		return
+	}
+	kv = append(kv, "size", len(data))
+	if l.dump {
+		kv = append(kv, "hex", hex.EncodeToString(data))
+	}
+	l.Debug(msg, kv...)
+}
+
+// command logs a command sent, the login commands are never dumped
+func (l connLogger) command(data []byte) {
+	if len(data) < 4 {
+		l.packet("send", data)
+		return
+	}
+	code := Tibero_CMD_CODE(binary.BigEndian.Uint32(data))
+	if code == AUTH || code == CHANGE_PASSWD {
+		l.dump = false
+	}
+	l.packet("send", data, "cmd", code)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -54,6 +55,36 @@ func (msg *Message) DeserializeFromBytes(data []byte) {
 	msg.Tsn = binary.BigEndian.Uint64(data[8:16])
 }
 
+// parseHeader decodes the 16 byte header heading every message
+func parseHeader(data []byte) (*Message, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("%w: header of %d bytes", ErrMalformedMessage, len(data))
+	}
+	msg := &Message{}
+	msg.DeserializeFromBytes(data)
+	if msg.MsgBodySize > MAX_MESSAGE_SIZE {
+		return nil, fmt.Errorf("message type %d announces %d bytes, more than the %d bytes limit", msg.MsgType, msg.MsgBodySize, MAX_MESSAGE_SIZE)
+	}
+	return msg, nil
+}
+
+func (msg *Message) header() *Message {
+	return msg
+}
+
+// NoticeMessage is sent by the server on its own, ahead of the reply of
+// the running command, to report a warning or an informational notice
+type NoticeMessage struct {
+	*Message
+	code uint32
+	text string
+}
+
+func (msg *NoticeMessage) deserialize(reader *ByteReader) {
+	msg.code = reader.read32Big()
+	msg.text = reader.ReadDBString()
+}
+
 type OkReply struct {
 	*Message
 	warningMsg string
@@ -133,9 +164,9 @@ type SessionInfoMessage struct {
 func (msg *SessionInfoMessage) deserialize(reader *ByteReader) {
 	msg.sessionId = reader.read32Big()
 	msg.serialNo = reader.read32Big()
-	size := reader.read32Big()
+	size := reader.count(reader.read32Big(), 12)
 	msg.nlsData = make([]*TbclntInfoParam, size)
-	for a := 0; a < int(size); a++ {
+	for a := 0; a < size; a++ {
 		tb := TbclntInfoParam{}
 		tb.deserialize(reader)
 		msg.nlsData[a] = &tb
@@ -168,16 +199,137 @@ type TbMsgExecuteCountReply struct {
 	ppid    *[8]byte
 	cntHigh uint32
 	cntLow  uint32
+	// generated key, when the statement returned one
+	lastInsertId *int64
+}
+
+func (msg *TbMsgExecuteCountReply) count() uint64 {
+	return uint64(msg.cntHigh)<<32 | uint64(msg.cntLow)
 }
 
 func (msg *TbMsgExecuteCountReply) deserialize(reader *ByteReader) {
-	msg.ppid = (*[8]byte)(reader.read(8))
+	msg.ppid = reader.readPpid()
 	msg.cntHigh = reader.read32Big()
 	msg.cntLow = reader.read32Big()
 }
 
+// TbMsgExecutePsmReply answers the execution of a PL/SQL block or CALL
+// carrying the values of OUT and IN OUT parameters in bind order
+type TbMsgExecutePsmReply struct {
+	TbMsgExecuteCountReply
+	outParams []interface{}
+}
+
+func (msg *TbMsgExecutePsmReply) deserialize(reader *ByteReader) {
+	msg.TbMsgExecuteCountReply.deserialize(reader)
+	size := reader.count(reader.read32Big(), 5)
+	msg.outParams = make([]interface{}, size)
+	for a := 0; a < size; a++ {
+		dtype := reader.read32Big()
+		msg.outParams[a] = reader.readDBValue(dtype)
+	}
+}
+
+// TbMsgFetchReply carries the next chunk of rows of an open cursor.
+// Rows are decoded by the caller which knows the column types.
+type TbMsgFetchReply struct {
+	*Message
+	rowCnt           uint32
+	isFetchCompleted uint32
+	rowChunkSize     uint32
+	rowChunk         []byte
+}
+
+func (msg *TbMsgFetchReply) deserialize(reader *ByteReader) {
+	msg.rowCnt = reader.read32Big()
+	msg.isFetchCompleted = reader.read32Big()
+	msg.rowChunkSize = reader.read32Big()
+	msg.rowChunk = reader.reBuild(msg.rowChunkSize).Data
+}
+
+func (msg *TbMsgFetchReply) rows(colMeta []*TbColumnDesc) ([]*TbResultSet, error) {
+	reader := CreateReader(nil, msg.rowChunk, 0)
+	reader.moveCursor(1)
+	rows := readRows(reader, msg.rowCnt, colMeta)
+	return rows, reader.Err()
+}
+
+// TbMsgExecuteReturningReply answers a DML statement with a RETURNING INTO
+// clause, carrying the returned rows of every returning parameter
+type TbMsgExecuteReturningReply struct {
+	TbMsgExecuteCountReply
+	returnParams [][]interface{}
+}
+
+func (msg *TbMsgExecuteReturningReply) deserialize(reader *ByteReader) {
+	msg.TbMsgExecuteCountReply.deserialize(reader)
+	size := reader.count(reader.read32Big(), 8)
+	msg.returnParams = make([][]interface{}, size)
+	for a := 0; a < size; a++ {
+		dtype := reader.read32Big()
+		rowCnt := reader.count(reader.read32Big(), 1)
+		rows := make([]interface{}, rowCnt)
+		for row := 0; row < rowCnt; row++ {
+			rows[row] = reader.readDBValue(dtype)
+		}
+		msg.returnParams[a] = rows
+	}
+}
+
+// TbMsgBatchUpdateReply answers BatchCMD with the affected count of
+// every row and the errors of the rows which failed
+type TbMsgBatchUpdateReply struct {
+	*Message
+	ppid   *[8]byte
+	counts []int64
+	errors map[int]error
+}
+
+func (msg *TbMsgBatchUpdateReply) deserialize(reader *ByteReader) {
+	msg.ppid = reader.readPpid()
+	size := reader.count(reader.read32Big(), 8)
+	msg.counts = make([]int64, size)
+	for a := 0; a < size; a++ {
+		msg.counts[a] = int64(reader.read64Big())
+	}
+	errCnt := reader.count(reader.read32Big(), 16)
+	msg.errors = make(map[int]error)
+	for a := 0; a < errCnt; a++ {
+		row := reader.read32Big()
+		vendorCode := reader.read32Big()
+		sqlState := reader.ReadDBString()
+		reason := reader.ReadDBString()
+		msg.errors[int(row)] = &SQLException{reason: reason, sqlState: sqlState, vendorCode: vendorCode}
+	}
+}
+
+// TbMsgXaReply carries the XA return code of an XA command
+type TbMsgXaReply struct {
+	*Message
+	rc int32
+}
+
+func (msg *TbMsgXaReply) deserialize(reader *ByteReader) {
+	msg.rc = int32(reader.read32Big())
+}
+
+// TbMsgXaRecoverReply lists the prepared branches known to the server
+type TbMsgXaRecoverReply struct {
+	*Message
+	xids []Xid
+}
+
+func (msg *TbMsgXaRecoverReply) deserialize(reader *ByteReader) {
+	size := reader.count(reader.read32Big(), 12)
+	msg.xids = make([]Xid, size)
+	for a := 0; a < size; a++ {
+		msg.xids[a].deserialize(reader)
+	}
+}
+
 type TbMsgExecutePrefetchReply struct {
 	*Message
+	tibero           *Tibero
 	ppid             *[8]byte
 	affectedCnt      uint32
 	csrId            uint32
@@ -193,34 +345,35 @@ type TbMsgExecutePrefetchReply struct {
 }
 
 func (msg *TbMsgExecutePrefetchReply) deserialize(reader *ByteReader) {
-	msg.ppid = (*[8]byte)(reader.read(8))
+	msg.ppid = reader.readPpid()
 	msg.affectedCnt = reader.read32Big()
 	msg.csrId = reader.read32Big()
 	msg.colCnt = reader.read32Big()
 	msg.hiddenColCnt = reader.read32Big()
-	size := reader.read32Big()
+	size := reader.count(reader.read32Big(), 24)
 	msg.colMeta = make([]*TbColumnDesc, size)
-	for a := 0; a < int(size); a++ {
+	for a := 0; a < size; a++ {
 		tb := &TbColumnDesc{}
 		tb.deserialize(reader)
 		msg.colMeta[a] = tb
-		printFormat("tpype[%d]\n", tb.dataType)
 	}
 	msg.rowCnt = reader.read32Big()
 	msg.isFetchCompleted = reader.read32Big()
 	msg.rowChunkSize = reader.read32Big()
-	reader = reader.reBuild(msg.rowChunkSize)
-	reader.moveCursor(1)
-	msg.resultIndex = 0
-	msg.resultSet = make([]*TbResultSet, int(msg.rowCnt))
-	for row := 0; row < int(msg.rowCnt); row++ {
-		msg.resultSet[row] = msg.readRow(reader)
+	chunk := reader.reBuild(msg.rowChunkSize)
+	if reader.Err() != nil {
+		return
 	}
-	reader.moveCursor(1)
+	chunk.moveCursor(1)
+	msg.resultIndex = 0
+	msg.resultSet = readRows(chunk, msg.rowCnt, msg.colMeta)
+	chunk.moveCursor(1)
+	// the rows are part of the reply, a malformed chunk fails it
+	reader.err = chunk.Err()
 }
 
 func (msg *TbMsgExecutePrefetchReply) nextRow() *TbResultSet {
-	if msg.resultIndex >= msg.rowCnt {
+	if msg.resultIndex >= uint32(len(msg.resultSet)) {
 		return nil
 	}
 	ts := msg.resultSet[msg.resultIndex]
@@ -230,9 +383,24 @@ func (msg *TbMsgExecutePrefetchReply) nextRow() *TbResultSet {
 	}
 	return nil
 }
-func (msg *TbMsgExecutePrefetchReply) readRow(reader *ByteReader) *TbResultSet {
+
+// readRows reads rowCnt rows of a row chunk, at least the 3 leading bytes
+// and the length byte of every column of every row must be there
+func readRows(reader *ByteReader, rowCnt uint32, colMeta []*TbColumnDesc) []*TbResultSet {
+	size := reader.count(rowCnt, 3+uint32(len(colMeta)))
+	rows := make([]*TbResultSet, size)
+	for row := 0; row < size; row++ {
+		rows[row] = readRow(reader, colMeta)
+		if reader.Err() != nil {
+			return rows[:row]
+		}
+	}
+	return rows
+}
+
+func readRow(reader *ByteReader, colMeta []*TbColumnDesc) *TbResultSet {
 	reader.moveCursor(3)
-	size := len(msg.colMeta)
+	size := len(colMeta)
 	item := &TbResultSet{}
 	item.values = make([]interface{}, size)
 	for a := 0; a < size; a++ {
@@ -241,7 +409,7 @@ func (msg *TbMsgExecutePrefetchReply) readRow(reader *ByteReader) *TbResultSet {
 		} else {
 			inx = uint32(reader.read16Big())
 		}
-		ttype := msg.colMeta[a].dataType
+		ttype := colMeta[a].dataType
 		item.values[a] = des(reader, ttype, inx)
 	}
 	return item
@@ -267,6 +435,49 @@ func (scaner StringScan) scan(b any) {
 	unexpectTypeErr(b)
 }
 
+// ParseBool accepts the usual flag encodings of CHAR columns:
+// 1/0, Y/N, T/F, YES/NO and TRUE/FALSE in any case
+func ParseBool(str string) (bool, error) {
+	switch strings.ToUpper(strings.TrimSpace(str)) {
+	case "1", "Y", "T", "YES", "TRUE":
+		return true, nil
+	case "0", "N", "F", "NO", "FALSE":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value %q", str)
+}
+
+// Bool implements sql.Scanner for flag columns, CHAR values are read
+// with ParseBool and numbers are true when not zero
+type Bool bool
+
+func (b *Bool) Scan(src any) error {
+	switch v := src.(type) {
+	case bool:
+		*b = Bool(v)
+	case int64:
+		*b = v != 0
+	case float64:
+		*b = v != 0
+	case string:
+		return b.parse(v)
+	case []byte:
+		return b.parse(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Bool", src)
+	}
+	return nil
+}
+
+func (b *Bool) parse(str string) error {
+	val, err := ParseBool(str)
+	if err != nil {
+		return err
+	}
+	*b = Bool(val)
+	return nil
+}
+
 type IntegerScan int64
 
 func (scaner IntegerScan) scan(b any) {
@@ -321,17 +532,58 @@ func (scaner TimestempScan) scan(b any) {
 }
 
 func des(reader *ByteReader, dtype uint32, length uint32) interface{} {
+	if length == 0 {
+		// NULL
+		return nil
+	}
 	tmp := reader.read(length)
+	if tmp == nil {
+		return nil
+	}
+	outer := reader
 	reader = CreateReader(nil, tmp, 0)
 	switch dtype {
-	case 1:
+	case DT_NUMBER:
 		bt := reader.read(length)
-		printFormat("num %s\n", DecodeNumber(bt))
 		return DecodeNumber(bt)
-	case 2, 3:
+	case DT_CHAR, DT_VARCHAR:
 		str := reader.read32String(length)
 		return str
-	case 12:
+	case DT_ROWID:
+		bt := reader.read(length)
+		return DecodeRowID(bt)
+	case DT_DATE:
+		bt := reader.read(length)
+		if length >= 8 {
+			return *toDate(bt)
+		}
+		return nil
+	case DT_RSET:
+		cur := &Cursor{}
+		cur.deserialize(reader)
+		if reader.Err() != nil {
+			outer.err = reader.Err()
+			return nil
+		}
+		return cur
+	case DT_ITV_YTM:
+		bt := reader.read(length)
+		if length >= 5 {
+			return toIntervalYM(bt)
+		}
+		return nil
+	case DT_ITV_DTS:
+		bt := reader.read(length)
+		if length >= 11 {
+			return toIntervalDS(bt)
+		}
+		return nil
+	case DT_RAW:
+		return reader.read(length)
+	case DT_BOOLEAN:
+		bt := reader.read(length)
+		return length > 0 && bt[0] != 0
+	case DT_BLOB:
 		// head := reader.readByte()
 		// var len uint32
 		// if head > 250 {
@@ -341,20 +593,32 @@ func des(reader *ByteReader, dtype uint32, length uint32) interface{} {
 		// }
 		// bt := reader.read(len)
 		return nil
-	case 7:
-		//timestamp
+	case DT_TIMESTAMP:
 		bt := reader.read(length)
 		var ts TbTimestamp = [12]byte{}
 		copy(ts[:], bt)
 		// return &ts
 		// log.Printf("date %+v\n", ts)
-		if ts.toDate() != nil {
-			return ts.toDate()
+		if date := ts.toDate(); date != nil {
+			return *date
 		}
 	}
 	return nil
 }
 
+// Code returns the TBR error number
+func (e *SQLException) Code() int {
+	code := int(int32(e.vendorCode))
+	if code < 0 {
+		code = -code
+	}
+	return code
+}
+
+func (e *SQLException) Error() string {
+	return fmt.Sprintf("TBR-%d: %s", e.Code(), e.reason)
+}
+
 type EReply struct {
 	*Message
 	noError       bool
@@ -377,8 +641,9 @@ func (msg *EReply) deserialize(reader *ByteReader) {
 			msg.noError = true
 		} else {
 			reader.moveCursor(4)
-			msg.exceptions = make([]*SQLException, size)
-			for a := 0; a < int(size); a++ {
+			cnt := reader.count(size, 12+4+9+6+712)
+			msg.exceptions = make([]*SQLException, cnt)
+			for a := 0; a < cnt; a++ {
 				reader.moveCursor(12)
 				vendorCode := reader.read32Big()
 				reader.moveCursor(9)
@@ -398,23 +663,46 @@ func (msg *EReply) deserialize(reader *ByteReader) {
 
 }
 
+// Code returns the TBR error number of the first exception, 0 when there is none
+func (msg *EReply) Code() int {
+	if len(msg.exceptions) == 0 {
+		return 0
+	}
+	return msg.exceptions[0].Code()
+}
+
+func (msg *EReply) Error() string {
+	if len(msg.exceptions) == 0 {
+		return "tibero: unknown error"
+	}
+	return msg.exceptions[0].Error()
+}
+
 func RSA_Encrypt(plainText []byte, publickey []byte) ([]byte, error) {
 	pk, err := BytesToPublicKey(publickey)
 	if err != nil {
 		return nil, err
 	}
-	return EncryptWithPublicKey(plainText, pk), nil
+	return EncryptWithPublicKey(plainText, pk)
 }
 
-func FormatPEM(public_key string) []byte {
-	ac, _ := base64.StdEncoding.DecodeString(public_key)
+// FormatPEM decodes the base64 session key of the public key exchange,
+// dropping anything sent after the PEM block
+func FormatPEM(public_key string) ([]byte, error) {
+	ac, err := base64.StdEncoding.DecodeString(public_key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server public key: %w", err)
+	}
 	raw := string(ac)
 	subfix := "-----END PUBLIC KEY-----"
 	lastIndex := strings.Index(raw, subfix)
-	if lastIndex > 0 {
-		return []byte(raw[0 : lastIndex+len(subfix)+1])
+	if lastIndex < 0 {
+		return nil, errors.New("invalid server public key: no END PUBLIC KEY marker")
+	}
+	if lastIndex+len(subfix) < len(raw) {
+		return []byte(raw[0 : lastIndex+len(subfix)+1]), nil
 	}
-	return ac
+	return ac, nil
 }
 
 func getMD5(data []byte) string {
@@ -0,0 +1,159 @@
+package gibero
+
+import (
+	"net"
+	"time"
+)
+
+// Metrics receives the measurements of the driver so they can be passed to
+// any metrics library. Methods are called on the connections' goroutines,
+// they must be cheap and safe for concurrent use. Embed NopMetrics to
+// implement only some of them.
+type Metrics interface {
+	// Connect reports the time taken to open and log in a physical
+	// connection, err is nil on success
+	Connect(elapsed time.Duration, err error)
+	// HandshakeFailed reports the login stage which failed: "connect",
+	// "tls", "key" for the public key exchange or "auth"
+	HandshakeFailed(stage string, err error)
+	// Statement reports an execution, kind is "select", "insert",
+	// "update", "delete", "merge", "call", "ddl", "transaction", "xa" or "other"
+	Statement(kind string, elapsed time.Duration, err error)
+	// Fetch reports a fetch round-trip and the number of rows it brought
+	Fetch(elapsed time.Duration, rows int)
+	// RowsFetched counts the rows received, with a query reply or a fetch
+	RowsFetched(rows int)
+	// BytesSent and BytesReceived count the bytes on the wire, TLS included
+	BytesSent(n int)
+	BytesReceived(n int)
+	// CursorOpened and CursorClosed follow the cursors holding rows on the
+	// server, a cursor is closed once all its rows are fetched, the rows
+	// are closed or the connection is closed
+	CursorOpened()
+	CursorClosed()
+}
+
+// SetMetrics reports the measurements of every new connection to metrics
+func (connector *TConnector) SetMetrics(metrics Metrics) {
+	connector.metrics = metrics
+}
+
+// NopMetrics ignores every measurement
+type NopMetrics struct{}
+
+func (NopMetrics) Connect(elapsed time.Duration, err error)                {}
+func (NopMetrics) HandshakeFailed(stage string, err error)                 {}
+func (NopMetrics) Statement(kind string, elapsed time.Duration, err error) {}
+func (NopMetrics) Fetch(elapsed time.Duration, rows int)                   {}
+func (NopMetrics) RowsFetched(rows int)                                    {}
+func (NopMetrics) BytesSent(n int)                                         {}
+func (NopMetrics) BytesReceived(n int)                                     {}
+func (NopMetrics) CursorOpened()                                           {}
+func (NopMetrics) CursorClosed()                                           {}
+
+// connMetrics reports to the metrics of the connector, the zero value reports nothing
+type connMetrics struct {
+	metrics Metrics
+}
+
+func (m connMetrics) handshakeFailed(stage string, err error) {
+	if m.metrics != nil {
+		m.metrics.HandshakeFailed(stage, err)
+	}
+}
+
+func (m connMetrics) statement(kind string, start time.Time, err error) {
+	if m.metrics != nil {
+		m.metrics.Statement(kind, time.Since(start), err)
+	}
+}
+
+func (m connMetrics) fetch(start time.Time, rows int) {
+	if m.metrics != nil {
+		m.metrics.Fetch(time.Since(start), rows)
+		m.metrics.RowsFetched(rows)
+	}
+}
+
+func (m connMetrics) rowsFetched(rows int) {
+	if m.metrics != nil && rows > 0 {
+		m.metrics.RowsFetched(rows)
+	}
+}
+
+func (m connMetrics) cursorOpened() {
+	if m.metrics != nil {
+		m.metrics.CursorOpened()
+	}
+}
+
+func (m connMetrics) cursorClosed() {
+	if m.metrics != nil {
+		m.metrics.CursorClosed()
+	}
+}
+
+func (tibero *Tibero) cursorOpened() {
+	tibero.openCursors++
+	tibero.metrics.cursorOpened()
+}
+
+// cursorClosed ignores the cursors already reported closed with the connection
+func (tibero *Tibero) cursorClosed() {
+	if tibero.openCursors > 0 {
+		tibero.openCursors--
+		tibero.metrics.cursorClosed()
+	}
+}
+
+// closeCursors reports the cursors left open when the connection closes
+func (tibero *Tibero) closeCursors() {
+	for tibero.openCursors > 0 {
+		tibero.cursorClosed()
+	}
+}
+
+// countingConn reports the bytes read and written on a connection
+type countingConn struct {
+	net.Conn
+	metrics Metrics
+}
+
+func (conn countingConn) Read(p []byte) (int, error) {
+	n, err := conn.Conn.Read(p)
+	if n > 0 {
+		conn.metrics.BytesReceived(n)
+	}
+	return n, err
+}
+
+func (conn countingConn) Write(p []byte) (int, error) {
+	n, err := conn.Conn.Write(p)
+	if n > 0 {
+		conn.metrics.BytesSent(n)
+	}
+	return n, err
+}
+
+// statementKind classifies sql by its first keyword
+func statementKind(sql string) string {
+	switch firstKeyword(sql) {
+	case "SELECT", "WITH":
+		return "select"
+	case "INSERT":
+		return "insert"
+	case "UPDATE":
+		return "update"
+	case "DELETE":
+		return "delete"
+	case "MERGE":
+		return "merge"
+	case "BEGIN", "DECLARE", "CALL":
+		return "call"
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "GRANT", "REVOKE", "COMMENT":
+		return "ddl"
+	case "COMMIT", "ROLLBACK", "SAVEPOINT", "SET":
+		return "transaction"
+	}
+	return "other"
+}
@@ -0,0 +1,380 @@
+package gibero
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutBinder binds a sql.Out argument. The IN part of an IN OUT parameter
+// is sent through the binder of its value, a pure OUT parameter is sent as null.
+type OutBinder struct {
+	dest  any
+	dtype byte
+	in    ParamBinder
+	// bound to the RETURNING INTO clause of a DML statement
+	returning bool
+}
+
+func (binder *OutBinder) mode() int {
+	if binder.returning {
+		return PARAM_MODE_RETURN
+	}
+	if binder.in != nil {
+		return PARAM_MODE_INOUT
+	}
+	return PARAM_MODE_OUT
+}
+
+func (binder *OutBinder) paramType() byte {
+	return binder.dtype
+}
+
+func (binder *OutBinder) deserialize(writer *ByteWriter) {
+	if binder.in != nil {
+		binder.in.deserialize(writer)
+		return
+	}
+	writer.WriteDBBytes(nil)
+}
+
+func (ps *PrepareStatement) setOut(out sql.Out) error {
+	binder := &OutBinder{dest: out.Dest, returning: isReturningDML(ps.sql)}
+	if out.In && binder.returning {
+		return errors.New("RETURNING INTO parameters can not be IN OUT")
+	}
+	if out.In {
+		val, err := checkValue(reflect.ValueOf(out.Dest).Elem().Interface())
+		if err != nil {
+			return err
+		}
+		inner := &PrepareStatement{sql: ps.sql, tibero: ps.tibero}
+		err = setting(inner, []driver.Value{val})
+		if err != nil {
+			return err
+		}
+		binder.in = inner.params.Front().Value.(ParamBinder)
+		binder.dtype = binder.in.paramType()
+	} else {
+		binder.dtype = outParamType(out.Dest)
+	}
+	ps.addParam(binder)
+	return nil
+}
+
+var (
+	cursorType     = reflect.TypeOf(Cursor{})
+	timeType       = reflect.TypeOf(time.Time{})
+	rowIDType      = reflect.TypeOf(RowID(""))
+	decimalType    = reflect.TypeOf(Decimal(""))
+	intervalYMType = reflect.TypeOf(IntervalYM{})
+	intervalDSType = reflect.TypeOf(IntervalDS{})
+)
+
+// outParamType picks the server type of an OUT parameter from its destination
+func outParamType(dest any) byte {
+	typ := reflect.TypeOf(dest).Elem()
+	// slices receive the rows of RETURNING INTO
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem()
+	}
+	// pointers receive NULL as nil
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case cursorType:
+		return DT_RSET
+	case timeType:
+		return DT_TIMESTAMP
+	case rowIDType:
+		return DT_ROWID
+	case decimalType:
+		return DT_NUMBER
+	case intervalYMType:
+		return DT_ITV_YTM
+	case intervalDSType:
+		return DT_ITV_DTS
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return DT_NUMBER
+	case reflect.Bool:
+		return DT_BOOLEAN
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return DT_RAW
+		}
+	}
+	return DT_VARCHAR
+}
+
+var returningDML = regexp.MustCompile(`(?is)^\s*(INSERT|UPDATE|DELETE|MERGE)\b.*\bRETURNING\b.*\bINTO\b`)
+
+// isReturningDML reports whether sql is a DML statement with a RETURNING INTO clause
+func isReturningDML(sql string) bool {
+	return returningDML.MatchString(stripLiterals(sql))
+}
+
+// stripLiterals replaces the string literals, quoted identifiers and
+// comments of sql by spaces so that their content is not taken for keywords
+func stripLiterals(sql string) string {
+	var out strings.Builder
+	for a := 0; a < len(sql); a++ {
+		end := -1
+		switch {
+		case sql[a] == '\'' || sql[a] == '"':
+			// a doubled quote escapes itself and continues the literal
+			end = a + 1
+			for end < len(sql) {
+				if sql[end] == sql[a] {
+					if end+1 < len(sql) && sql[end+1] == sql[a] {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+		case strings.HasPrefix(sql[a:], "--"):
+			end = strings.IndexByte(sql[a:], '\n')
+			if end >= 0 {
+				end += a
+			}
+		case strings.HasPrefix(sql[a:], "/*"):
+			end = strings.Index(sql[a+2:], "*/")
+			if end >= 0 {
+				end += a + 3
+			}
+		default:
+			out.WriteByte(sql[a])
+			continue
+		}
+		out.WriteByte(' ')
+		if end < 0 || end >= len(sql) {
+			break
+		}
+		a = end
+	}
+	return out.String()
+}
+
+// assignReturning stores the rows returned for each RETURNING INTO parameter.
+// A slice destination receives every row, any other destination at most one.
+// It reports the generated key when a single row returned an integer first.
+func (ps *PrepareStatement) assignReturning(values [][]interface{}) (*int64, error) {
+	var lastInsertId *int64
+	index := 0
+	for ele := ps.params.Front(); ele != nil; ele = ele.Next() {
+		binder, ok := ele.Value.(*OutBinder)
+		if !ok {
+			continue
+		}
+		if index >= len(values) {
+			return nil, errors.New("missing value of returning parameter")
+		}
+		rows := values[index]
+		dv := reflect.ValueOf(binder.dest).Elem()
+		if dv.Kind() == reflect.Slice && dv.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(dv.Type(), len(rows), len(rows))
+			for a, row := range rows {
+				err := assignValue(slice.Index(a).Addr().Interface(), row)
+				if err != nil {
+					return nil, fmt.Errorf("returning parameter %d row %d: %w", index+1, a, err)
+				}
+			}
+			dv.Set(slice)
+		} else {
+			if len(rows) > 1 {
+				return nil, fmt.Errorf("returning parameter %d: %d rows returned into %T, use a slice", index+1, len(rows), binder.dest)
+			}
+			var val interface{}
+			if len(rows) == 1 {
+				val = rows[0]
+			}
+			err := assignValue(binder.dest, val)
+			if err != nil {
+				return nil, fmt.Errorf("returning parameter %d: %w", index+1, err)
+			}
+		}
+		if index == 0 && len(rows) == 1 {
+			if id, ok := rows[0].(int64); ok {
+				lastInsertId = &id
+			}
+		}
+		index++
+	}
+	return lastInsertId, nil
+}
+
+func (ps *PrepareStatement) assignOutParams(values []interface{}) error {
+	if ps.params == nil {
+		return nil
+	}
+	index := 0
+	for ele := ps.params.Front(); ele != nil; ele = ele.Next() {
+		binder, ok := ele.Value.(*OutBinder)
+		if !ok {
+			continue
+		}
+		if index >= len(values) {
+			return errors.New("missing value of output parameter")
+		}
+		err := assignValue(binder.dest, values[index])
+		if err != nil {
+			return fmt.Errorf("output parameter %d: %w", index+1, err)
+		}
+		if cur, ok := binder.dest.(*Cursor); ok {
+			cur.tibero = ps.tibero
+			if cur.tibero != nil && !cur.isFetchCompleted {
+				ps.tibero.cursorOpened()
+			}
+		}
+		index++
+	}
+	return nil
+}
+
+// assignValue stores a decoded server value into dest the way
+// database/sql would scan it
+func assignValue(dest any, src any) error {
+	if ts, ok := src.(*time.Time); ok {
+		if ts == nil {
+			src = nil
+		} else {
+			src = *ts
+		}
+	}
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(src)
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination %T is not a pointer", dest)
+	}
+	dv = dv.Elem()
+	if src == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+	if dv.Kind() == reflect.Pointer {
+		ptr := reflect.New(dv.Type().Elem())
+		err := assignValue(ptr.Interface(), src)
+		if err != nil {
+			return err
+		}
+		dv.Set(ptr)
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dv.Type()) {
+		if bt, ok := src.([]byte); ok {
+			src = append([]byte(nil), bt...)
+			sv = reflect.ValueOf(src)
+		}
+		dv.Set(sv)
+		return nil
+	}
+	switch dv.Kind() {
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dv.SetString(v)
+		case []byte:
+			dv.SetString(string(v))
+		case int64:
+			dv.SetString(strconv.FormatInt(v, 10))
+		case float64:
+			dv.SetString(strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			dv.SetString(v.Format(time.RFC3339Nano))
+		default:
+			dv.SetString(fmt.Sprint(v))
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var val int64
+		switch v := src.(type) {
+		case int64:
+			val = v
+		case float64:
+			val = int64(v)
+			if float64(val) != v {
+				return fmt.Errorf("cannot store %v in %T", v, dest)
+			}
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+			val = i
+		default:
+			return fmt.Errorf("cannot store %T in %T", src, dest)
+		}
+		if dv.OverflowInt(val) {
+			return fmt.Errorf("value %d overflows %T", val, dest)
+		}
+		dv.SetInt(val)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var val uint64
+		switch v := src.(type) {
+		case int64:
+			if v < 0 {
+				return fmt.Errorf("cannot store %d in %T", v, dest)
+			}
+			val = uint64(v)
+		case float64:
+			val = uint64(v)
+			if v < 0 || float64(val) != v {
+				return fmt.Errorf("cannot store %v in %T", v, dest)
+			}
+		default:
+			return fmt.Errorf("cannot store %T in %T", src, dest)
+		}
+		if dv.OverflowUint(val) {
+			return fmt.Errorf("value %d overflows %T", val, dest)
+		}
+		dv.SetUint(val)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch v := src.(type) {
+		case int64:
+			dv.SetFloat(float64(v))
+		case float64:
+			dv.SetFloat(v)
+		default:
+			return fmt.Errorf("cannot store %T in %T", src, dest)
+		}
+		return nil
+	case reflect.Bool:
+		switch v := src.(type) {
+		case int64:
+			dv.SetBool(v != 0)
+		case float64:
+			dv.SetBool(v != 0)
+		case string:
+			b, err := ParseBool(v)
+			if err != nil {
+				return err
+			}
+			dv.SetBool(b)
+		default:
+			return fmt.Errorf("cannot store %T in %T", src, dest)
+		}
+		return nil
+	}
+	if sv.Type().ConvertibleTo(dv.Type()) && sv.Kind() == dv.Kind() {
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot store %T in %T", src, dest)
+}
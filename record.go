@@ -0,0 +1,109 @@
+package gibero
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Recorder wraps a DBServer and records every message it sends and
+// receives in the trace format, recordings are replayed by tiberotest
+type Recorder struct {
+	DBServer
+	trace  *TraceWriter
+	logger connLogger
+	// received message completed by the row chunks read after it
+	pending   []byte
+	pendingAt time.Time
+}
+
+func NewRecorder(server DBServer, trace *TraceWriter) *Recorder {
+	return &Recorder{DBServer: server, trace: trace}
+}
+
+// recordReader appends the bytes read after a message body to its record
+type recordReader struct {
+	r      io.Reader
+	record *Recorder
+}
+
+func (rr recordReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if rr.record.pending != nil {
+		rr.record.pending = append(rr.record.pending, p[:n]...)
+	}
+	return n, err
+}
+
+// flushPending records the last received message once nothing more can be read for it
+func (r *Recorder) flushPending() {
+	if r.trace == nil || r.pending == nil {
+		return
+	}
+	err := r.trace.Record(TraceReceived, r.pendingAt, r.pending)
+	if err != nil {
+		r.stop(err)
+	}
+	r.pending = nil
+}
+
+func (r *Recorder) stop(err error) {
+	r.logger.Warn("trace stopped", "error", err)
+	r.trace.Close()
+	r.trace = nil
+}
+
+func (r *Recorder) readMessage() (*Message, *ByteReader, error) {
+	r.flushPending()
+	msg, reader, err := r.DBServer.readMessage()
+	if err != nil || r.trace == nil {
+		return msg, reader, err
+	}
+	head := make([]byte, 16, 16+len(reader.Data))
+	binary.BigEndian.PutUint32(head[0:4], msg.MsgType)
+	binary.BigEndian.PutUint32(head[4:8], msg.MsgBodySize)
+	binary.BigEndian.PutUint64(head[8:16], msg.Tsn)
+	r.pending = append(head, reader.Data...)
+	r.pendingAt = time.Now()
+	reader.reader = recordReader{r: reader.reader, record: r}
+	return msg, reader, nil
+}
+
+func (r *Recorder) writeTo(data []byte) error {
+	r.flushPending()
+	if r.trace != nil {
+		err := r.trace.Record(TraceSent, time.Now(), data)
+		if err != nil {
+			r.stop(err)
+		}
+	}
+	return r.DBServer.writeTo(data)
+}
+
+// startTLS upgrades the wrapped server, messages are still recorded in clear
+func (r *Recorder) startTLS(config *tls.Config) error {
+	upgrader, ok := r.DBServer.(tlsUpgrader)
+	if !ok {
+		return fmt.Errorf("%T can not start TLS", r.DBServer)
+	}
+	return upgrader.startTLS(config)
+}
+
+func (r *Recorder) setDeadline(t time.Time) error {
+	d, ok := r.DBServer.(deadliner)
+	if !ok {
+		return nil
+	}
+	return d.setDeadline(t)
+}
+
+func (r *Recorder) close() error {
+	if r.trace != nil {
+		r.flushPending()
+		r.trace.Close()
+		r.trace = nil
+	}
+	return r.DBServer.close()
+}
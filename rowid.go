@@ -0,0 +1,77 @@
+package gibero
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// RowID is the textual form of a ROWID or UROWID value.
+//
+// A physical rowid is rendered the way Tibero prints it: 18 base64 digits
+// holding the segment (6), file (3), block (6) and row (3) numbers.
+// A logical UROWID (index organized tables) is rendered as '*' followed by
+// the standard base64 encoding of its raw bytes.
+// RowID can be passed back as a statement parameter, it is sent as text
+// for the server to convert. The physical form is the one the server
+// prints; the logical form is this driver's own and has not been checked
+// against the server's UROWID text, compare logical rowids on the Go side.
+type RowID string
+
+const rowIDDigits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// physical rowid on the wire: segment(4) file(2) block(4) row(2)
+const rowIDRawSize = 12
+
+func (id RowID) String() string {
+	return string(id)
+}
+
+// IsLogical reports whether the rowid is a logical UROWID.
+func (id RowID) IsLogical() bool {
+	return strings.HasPrefix(string(id), "*")
+}
+
+// Parts returns the segment, file, block and row numbers of a physical rowid.
+func (id RowID) Parts() (segment uint32, file uint16, block uint32, row uint16, err error) {
+	str := string(id)
+	if len(str) != 18 {
+		return 0, 0, 0, 0, errors.New("invalid rowid")
+	}
+	var v [4]uint64
+	offsets := [5]int{0, 6, 9, 15, 18}
+	for a := 0; a < 4; a++ {
+		for _, c := range str[offsets[a]:offsets[a+1]] {
+			digit := strings.IndexRune(rowIDDigits, c)
+			if digit < 0 {
+				return 0, 0, 0, 0, errors.New("invalid rowid")
+			}
+			v[a] = v[a]<<6 | uint64(digit)
+		}
+	}
+	if v[0] > 0xffffffff || v[1] > 0xffff || v[2] > 0xffffffff || v[3] > 0xffff {
+		return 0, 0, 0, 0, errors.New("invalid rowid")
+	}
+	return uint32(v[0]), uint16(v[1]), uint32(v[2]), uint16(v[3]), nil
+}
+
+func encodeRowIDPart(buf *strings.Builder, val uint64, digits int) {
+	for a := digits - 1; a >= 0; a-- {
+		buf.WriteByte(rowIDDigits[(val>>(6*a))&63])
+	}
+}
+
+// DecodeRowID renders the raw bytes of a ROWID or UROWID value,
+// see RowID for the two forms
+func DecodeRowID(data []byte) RowID {
+	if len(data) != rowIDRawSize {
+		return RowID("*" + base64.StdEncoding.EncodeToString(data))
+	}
+	var buf strings.Builder
+	encodeRowIDPart(&buf, uint64(binary.BigEndian.Uint32(data[0:4])), 6)
+	encodeRowIDPart(&buf, uint64(binary.BigEndian.Uint16(data[4:6])), 3)
+	encodeRowIDPart(&buf, uint64(binary.BigEndian.Uint32(data[6:10])), 6)
+	encodeRowIDPart(&buf, uint64(binary.BigEndian.Uint16(data[10:12])), 3)
+	return RowID(buf.String())
+}
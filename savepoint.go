@@ -0,0 +1,94 @@
+package gibero
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var errNoTransaction = errors.New("savepoints require a running transaction")
+
+var savepointName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]{0,29}$`)
+
+func checkSavepoint(name string) (string, error) {
+	if !savepointName.MatchString(name) {
+		return "", fmt.Errorf("invalid savepoint name %q", name)
+	}
+	return strings.ToUpper(name), nil
+}
+
+func (conn *TConn) savepointIndex(name string) int {
+	for a := len(conn.savepoints) - 1; a >= 0; a-- {
+		if conn.savepoints[a] == name {
+			return a
+		}
+	}
+	return -1
+}
+
+// Savepoint marks a point of the running transaction which RollbackTo can
+// return to. It is reachable through sql.Conn.Raw:
+//
+//	tx, _ := conn.BeginTx(ctx, nil)
+//	conn.Raw(func(dc any) error { return dc.(*gibero.TConn).Savepoint("step1") })
+func (conn *TConn) Savepoint(name string) error {
+	if conn.tx == nil {
+		return errNoTransaction
+	}
+	name, err := checkSavepoint(name)
+	if err != nil {
+		return err
+	}
+	err = conn.tibero.executeInTx("SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+	// reusing a name moves the savepoint
+	if index := conn.savepointIndex(name); index >= 0 {
+		conn.savepoints = append(conn.savepoints[:index], conn.savepoints[index+1:]...)
+	}
+	conn.savepoints = append(conn.savepoints, name)
+	return nil
+}
+
+// RollbackTo undoes the work done after the savepoint. The savepoint stays
+// valid while the ones created after it are discarded.
+func (conn *TConn) RollbackTo(name string) error {
+	if conn.tx == nil {
+		return errNoTransaction
+	}
+	name, err := checkSavepoint(name)
+	if err != nil {
+		return err
+	}
+	index := conn.savepointIndex(name)
+	if index < 0 {
+		return fmt.Errorf("unknown savepoint %s", name)
+	}
+	_, err = conn.tibero.rollback(name)
+	if err != nil {
+		return err
+	}
+	conn.savepoints = conn.savepoints[:index+1]
+	return nil
+}
+
+// ReleaseSavepoint forgets the savepoint and the ones created after it.
+// Tibero has no RELEASE SAVEPOINT statement so nothing is sent to the server,
+// the savepoint simply can no longer be rolled back to.
+func (conn *TConn) ReleaseSavepoint(name string) error {
+	if conn.tx == nil {
+		return errNoTransaction
+	}
+	name, err := checkSavepoint(name)
+	if err != nil {
+		return err
+	}
+	index := conn.savepointIndex(name)
+	if index < 0 {
+		return fmt.Errorf("unknown savepoint %s", name)
+	}
+	conn.savepoints = conn.savepoints[:index]
+	return nil
+}
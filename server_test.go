@@ -0,0 +1,183 @@
+package gibero_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sankooc/gibero"
+	"github.com/sankooc/gibero/tiberotest"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetrics struct {
+	gibero.NopMetrics
+	mu         sync.Mutex
+	connects   int
+	failures   []string
+	statements []string
+	fetches    int
+	rows       int
+	sent       int
+	received   int
+	cursors    int
+}
+
+func (m *testMetrics) Connect(elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connects++
+}
+
+func (m *testMetrics) HandshakeFailed(stage string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, stage)
+}
+
+func (m *testMetrics) Statement(kind string, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		kind += " failed"
+	}
+	m.statements = append(m.statements, kind)
+}
+
+func (m *testMetrics) Fetch(elapsed time.Duration, rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetches++
+}
+
+func (m *testMetrics) RowsFetched(rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows += rows
+}
+
+func (m *testMetrics) BytesSent(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent += n
+}
+
+func (m *testMetrics) BytesReceived(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received += n
+}
+
+func (m *testMetrics) CursorOpened() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cursors++
+}
+
+func (m *testMetrics) CursorClosed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cursors--
+}
+
+func TestMetrics(t *testing.T) {
+	assert := require.New(t)
+	server := tiberotest.NewServer()
+	defer server.Close()
+	columns := []tiberotest.Column{{Name: "N", Type: gibero.DT_NUMBER}}
+	server.On("SELECT N FROM NUMS", tiberotest.Rows(columns, []any{1}, []any{2}, []any{3}))
+	server.On("UPDATE NUMS SET N = 0", tiberotest.Exec(3))
+	server.On("DELETE FROM NUMS", tiberotest.Fail(1234, "resource busy"))
+	server.SetFetchSize(2)
+
+	metrics := &testMetrics{}
+	connector, err := gibero.NewConnector(server.DSN())
+	assert.Nil(err)
+	connector.SetMetrics(metrics)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.Query("SELECT N FROM NUMS")
+	assert.Nil(err)
+	assert.Equal(1, metrics.cursors)
+	for rows.Next() {
+	}
+	assert.Nil(rows.Err())
+	assert.Equal(0, metrics.cursors)
+	rows, err = db.Query("SELECT N FROM NUMS")
+	assert.Nil(err)
+	assert.Nil(rows.Close())
+	_, err = db.Exec("UPDATE NUMS SET N = 0")
+	assert.Nil(err)
+	_, err = db.Exec("DELETE FROM NUMS")
+	assert.NotNil(err)
+	tx, err := db.Begin()
+	assert.Nil(err)
+	assert.Nil(tx.Commit())
+
+	metrics.mu.Lock()
+	assert.Equal(1, metrics.connects)
+	assert.Empty(metrics.failures)
+	assert.Equal([]string{"select", "select", "update", "delete failed", "transaction"}, metrics.statements)
+	assert.Equal(1, metrics.fetches)
+	assert.Equal(5, metrics.rows)
+	assert.Equal(0, metrics.cursors)
+	assert.Greater(metrics.sent, 0)
+	assert.Greater(metrics.received, 0)
+	metrics.mu.Unlock()
+
+	// a connection closed with a result set still open closes its cursor
+	dc, err := connector.Connect(context.Background())
+	assert.Nil(err)
+	stmt, err := dc.Prepare("SELECT N FROM NUMS")
+	assert.Nil(err)
+	open, err := stmt.Query(nil)
+	assert.Nil(err)
+	assert.Equal(1, metrics.cursors)
+	assert.Nil(dc.Close())
+	assert.Equal(0, metrics.cursors)
+	open.Close()
+	assert.Equal(0, metrics.cursors)
+
+	server.SetPassword("test", "secret")
+	failing, err := gibero.NewConnector(server.DSN())
+	assert.Nil(err)
+	failing.SetMetrics(metrics)
+	_, err = failing.Connect(context.Background())
+	assert.NotNil(err)
+	assert.Equal([]string{"auth"}, metrics.failures)
+	assert.Equal(3, metrics.connects)
+
+	// an expired password fails the login as well
+	server.SetPassword("test", "test")
+	server.ExpirePassword("test")
+	_, err = failing.Connect(context.Background())
+	assert.True(gibero.IsPasswordExpired(err))
+	assert.Equal([]string{"auth", "auth"}, metrics.failures)
+}
+
+func TestBool(t *testing.T) {
+	assert := require.New(t)
+	server := tiberotest.NewServer()
+	defer server.Close()
+	columns := []tiberotest.Column{{Name: "ACTIVE", Type: gibero.DT_CHAR}, {Name: "N", Type: gibero.DT_NUMBER}}
+	server.On("SELECT ACTIVE, N FROM FLAGS", tiberotest.Rows(columns, []any{"Y", 1}, []any{"N", 0}, []any{"1", 7}))
+
+	db, err := sql.Open("tibero", server.DSN())
+	assert.Nil(err)
+	defer db.Close()
+	rows, err := db.Query("SELECT ACTIVE, N FROM FLAGS")
+	assert.Nil(err)
+	defer rows.Close()
+	var got [][2]bool
+	for rows.Next() {
+		var active, n gibero.Bool
+		assert.Nil(rows.Scan(&active, &n))
+		got = append(got, [2]bool{bool(active), bool(n)})
+	}
+	assert.Nil(rows.Err())
+	assert.Equal([][2]bool{{true, true}, {false, false}, {true, true}}, got)
+}
@@ -0,0 +1,255 @@
+package tiberotest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sankooc/gibero"
+)
+
+// ErrReplayMismatch is answered to a command missing from the recording
+const ErrReplayMismatch = 90002
+
+// ReplayServer serves a session recorded with gibero.TConnector.SetTraceSink.
+// Every connection is served the recording from its start: a command is
+// matched against the recorded commands not used yet and answered with the
+// replies that followed it. The tsn and the login fields that change from a
+// run to the other, such as the encrypted password and the client host,
+// are left out of the match. Other commands must be identical, bound values
+// included, unless SetMatcher relaxes the comparison.
+type ReplayServer struct {
+	listener net.Listener
+	records  []*gibero.TraceRecord
+	matcher  Matcher
+
+	mu         sync.Mutex
+	mismatches []string
+	conns      map[net.Conn]bool
+	wg         sync.WaitGroup
+}
+
+// NewReplayServer reads the recording from r and starts serving it on a local port
+func NewReplayServer(r io.Reader) (*ReplayServer, error) {
+	reader, err := gibero.NewTraceReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var records []*gibero.TraceRecord
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record.Data) < 16 {
+			return nil, fmt.Errorf("tiberotest: truncated message in recording")
+		}
+		records = append(records, record)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &ReplayServer{listener: listener, records: records, conns: map[net.Conn]bool{}}
+	server.wg.Add(1)
+	go server.serve()
+	return server, nil
+}
+
+// Matcher tells whether the recorded command answers the received one.
+// Both are whole commands with the tsn cleared.
+type Matcher func(recorded []byte, received []byte) bool
+
+// SetMatcher compares the commands with match instead of byte for byte, so
+// that values changing from a run to the other such as time.Now() can be
+// bound. The login commands are always matched by user and database name.
+// Call it before opening connections.
+func (server *ReplayServer) SetMatcher(match Matcher) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.matcher = match
+}
+
+// MatchSQL matches the commands carrying SQL text by their code and text,
+// whatever values are bound. Other commands must be identical.
+func MatchSQL(recorded []byte, received []byte) bool {
+	recordedSQL, ok := commandSQL(recorded)
+	receivedSQL, ok2 := commandSQL(received)
+	if !ok || !ok2 {
+		return bytes.Equal(recorded, received)
+	}
+	return bytes.Equal(recorded[0:4], received[0:4]) && recordedSQL == receivedSQL
+}
+
+// commandSQL returns the SQL text of the commands executing a statement
+func commandSQL(command []byte) (string, bool) {
+	if len(command) < 16 {
+		return "", false
+	}
+	reader := newCommandReader(command[16:])
+	switch binary.BigEndian.Uint32(command[0:4]) {
+	case cmdSQL:
+		reader.Cur += 8
+	case cmdPrepareExecute, cmdBatch:
+	default:
+		return "", false
+	}
+	sql, err := reader.string()
+	return sql, err == nil && reader.Err() == nil
+}
+
+// Addr returns the host:port the server listens on
+func (server *ReplayServer) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// DSN returns a dsn logging in as the recorded user, the password is not checked
+func (server *ReplayServer) DSN() string {
+	user, dbname := "replay", "replay"
+	for _, record := range server.records {
+		if record.Direction == gibero.TraceSent && record.MsgType == cmdAuth {
+			reader := newCommandReader(record.Data[16:])
+			reader.Cur += 12
+			user, _ = reader.string()
+			dbname, _ = reader.string()
+			break
+		}
+	}
+	return fmt.Sprintf("tibero://%s:replay@%s/%s", user, server.Addr(), dbname)
+}
+
+// Mismatches returns the commands that were not found in the recording
+func (server *ReplayServer) Mismatches() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string(nil), server.mismatches...)
+}
+
+// Close stops the server and closes its connections
+func (server *ReplayServer) Close() error {
+	err := server.listener.Close()
+	server.mu.Lock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mu.Unlock()
+	server.wg.Wait()
+	return err
+}
+
+func (server *ReplayServer) serve() {
+	defer server.wg.Done()
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mu.Lock()
+		server.conns[conn] = true
+		server.mu.Unlock()
+		server.wg.Add(1)
+		go func() {
+			defer server.wg.Done()
+			server.replay(conn)
+			server.mu.Lock()
+			delete(server.conns, conn)
+			server.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (server *ReplayServer) replay(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	used := make([]bool, len(server.records))
+	server.mu.Lock()
+	matcher := server.matcher
+	server.mu.Unlock()
+	// the connect message is sent before any command
+	server.writeReplies(writer, 0)
+	err := writer.Flush()
+	for err == nil {
+		var head [16]byte
+		_, err = io.ReadFull(reader, head[:])
+		if err != nil {
+			return
+		}
+		command := make([]byte, 16+binary.BigEndian.Uint32(head[4:8]))
+		copy(command, head[:])
+		_, err = io.ReadFull(reader, command[16:])
+		if err != nil {
+			return
+		}
+		index := server.match(command, used, matcher)
+		if index < 0 {
+			record := &gibero.TraceRecord{Direction: gibero.TraceSent, Data: command}
+			server.mu.Lock()
+			server.mismatches = append(server.mismatches, record.Describe())
+			server.mu.Unlock()
+			writer.Write(errorReply(ErrReplayMismatch, "tiberotest: command not in the recording"))
+		} else {
+			used[index] = true
+			server.writeReplies(writer, index+1)
+		}
+		err = writer.Flush()
+	}
+}
+
+// match returns the first unused recorded command matching command, -1 if none does
+func (server *ReplayServer) match(command []byte, used []bool, matcher Matcher) int {
+	key := matchKey(command)
+	code := binary.BigEndian.Uint32(command[0:4])
+	if matcher == nil || code == cmdAuth || code == cmdChangePassword {
+		matcher = bytes.Equal
+	}
+	for index, record := range server.records {
+		if used[index] || record.Direction != gibero.TraceSent {
+			continue
+		}
+		if matcher(matchKey(record.Data), key) {
+			return index
+		}
+	}
+	return -1
+}
+
+// writeReplies writes the received records from index up to the next sent one
+func (server *ReplayServer) writeReplies(writer *bufio.Writer, index int) {
+	for ; index < len(server.records); index++ {
+		record := server.records[index]
+		if record.Direction != gibero.TraceReceived {
+			return
+		}
+		writer.Write(record.Data)
+	}
+}
+
+// matchKey returns the parts of a command that are stable between runs
+func matchKey(command []byte) []byte {
+	key := append([]byte(nil), command...)
+	// tsn
+	copy(key[8:16], make([]byte, 8))
+	code := binary.BigEndian.Uint32(command[0:4])
+	switch code {
+	case cmdAuth:
+		// user and database name, not the encrypted password nor the client details
+		reader := newCommandReader(command[16:])
+		reader.Cur += 12
+		user, _ := reader.string()
+		dbname, _ := reader.string()
+		return []byte(fmt.Sprintf("%d %s %s", code, user, dbname))
+	case cmdChangePassword:
+		reader := newCommandReader(command[16:])
+		user, _ := reader.string()
+		return []byte(fmt.Sprintf("%d %s", code, user))
+	}
+	return key
+}
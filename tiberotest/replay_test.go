@@ -0,0 +1,89 @@
+package tiberotest
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sankooc/gibero"
+	"github.com/stretchr/testify/require"
+)
+
+type recording struct {
+	bytes.Buffer
+}
+
+func (r *recording) Close() error {
+	return nil
+}
+
+func runSession(t *testing.T, db *sql.DB) []string {
+	assert := require.New(t)
+	db.SetMaxOpenConns(1)
+	rows, err := db.Query("SELECT NAME FROM USERS WHERE ID > ?", 1)
+	assert.Nil(err)
+	var names []string
+	for rows.Next() {
+		var name string
+		assert.Nil(rows.Scan(&name))
+		names = append(names, name)
+	}
+	assert.Nil(rows.Err())
+	result, err := db.Exec("UPDATE USERS SET NAME = ?", "bob")
+	assert.Nil(err)
+	count, _ := result.RowsAffected()
+	assert.Equal(int64(2), count)
+	return names
+}
+
+func TestReplay(t *testing.T) {
+	assert := require.New(t)
+	server := NewServer()
+	server.On("SELECT NAME FROM USERS WHERE ID > ?", Rows([]Column{{Name: "NAME", Type: gibero.DT_VARCHAR}}, []any{"bob"}, []any{"carol"}))
+	server.On("UPDATE USERS SET NAME = ?", Exec(2))
+	connector, err := gibero.NewConnector(server.DSN())
+	assert.Nil(err)
+	record := &recording{}
+	connector.SetTraceSink(func(connID uint64) (io.WriteCloser, error) { return record, nil })
+	db := sql.OpenDB(connector)
+	recorded := runSession(t, db)
+	assert.Nil(db.Close())
+	server.Close()
+
+	replay, err := NewReplayServer(bytes.NewReader(record.Bytes()))
+	assert.Nil(err)
+	defer replay.Close()
+	assert.True(strings.HasPrefix(replay.DSN(), "tibero://test:replay@"))
+	db, err = sql.Open("tibero", replay.DSN())
+	assert.Nil(err)
+	defer db.Close()
+	assert.Equal(recorded, runSession(t, db))
+	assert.Equal([]string{"bob", "carol"}, recorded)
+
+	_, err = db.Exec("DELETE FROM USERS")
+	assert.EqualError(err, "TBR-90002: tiberotest: command not in the recording")
+	assert.Len(replay.Mismatches(), 1)
+	assert.Contains(replay.Mismatches()[0], `sql="DELETE FROM USERS"`)
+
+	// the bound values must match unless the matcher ignores them
+	relaxed, err := NewReplayServer(bytes.NewReader(record.Bytes()))
+	assert.Nil(err)
+	defer relaxed.Close()
+	relaxed.SetMatcher(MatchSQL)
+	db, err = sql.Open("tibero", relaxed.DSN())
+	assert.Nil(err)
+	defer db.Close()
+	var name string
+	assert.Nil(db.QueryRow("SELECT NAME FROM USERS WHERE ID > ?", 7).Scan(&name))
+	assert.Equal("bob", name)
+	_, err = db.Exec("UPDATE USERS SET NAME = ?", "dave")
+	assert.Nil(err)
+	assert.Empty(relaxed.Mismatches())
+	_, err = db.Exec("UPDATE USERS SET NAME = ?", "erin")
+	assert.EqualError(err, "TBR-90002: tiberotest: command not in the recording")
+
+	_, err = NewReplayServer(strings.NewReader("not a trace"))
+	assert.NotNil(err)
+}
@@ -0,0 +1,502 @@
+// Package tiberotest provides a fake Tibero server speaking the wire protocol
+// of gibero on a local listener, so that the driver and the applications
+// using it can be tested without a database.
+//
+//	server := tiberotest.NewServer()
+//	defer server.Close()
+//	server.On("SELECT ID, NAME FROM USERS", tiberotest.Rows(
+//		[]tiberotest.Column{{Name: "ID", Type: gibero.DT_NUMBER}, {Name: "NAME", Type: gibero.DT_VARCHAR}},
+//		[]any{1, "alice"},
+//	))
+//	db, _ := sql.Open("tibero", server.DSN())
+package tiberotest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/sankooc/gibero"
+)
+
+// Column describes a column of a result set, Type is one of the gibero DT_ constants
+type Column struct {
+	Name string
+	Type uint32
+}
+
+// Error is a server error answered to a statement
+type Error struct {
+	Code    int
+	Message string
+}
+
+// Response is the canned answer to a statement
+type Response struct {
+	// columns and rows of a query
+	Columns []Column
+	Rows    [][]any
+	// affected row count of a DML statement, or of every row of a batch
+	RowsAffected int64
+	// answered instead of the result when set
+	Err *Error
+}
+
+// Exec answers a DML statement affecting rowsAffected rows
+func Exec(rowsAffected int64) *Response {
+	return &Response{RowsAffected: rowsAffected}
+}
+
+// Rows answers a query with a result set
+func Rows(columns []Column, rows ...[]any) *Response {
+	return &Response{Columns: columns, Rows: rows}
+}
+
+// Fail answers a statement with the server error TBR-code
+func Fail(code int, message string) *Response {
+	return &Response{Err: &Error{Code: code, Message: message}}
+}
+
+// error numbers of the server
+const (
+	ErrNoResponse      = 90001
+	ErrLoginFailed     = 17001
+	ErrPasswordExpired = gibero.TBR_PASSWORD_EXPIRED
+)
+
+// Server is a fake Tibero server. Statements are answered with the
+// responses registered with On, then by the Handle function.
+type Server struct {
+	listener net.Listener
+	key      *rsa.PrivateKey
+	pem      []byte
+
+	mu        sync.Mutex
+	responses map[string]*Response
+	handler   func(sql string) *Response
+	queries   []string
+	passwords map[string]string
+	expired   map[string]bool
+	fetchSize int
+	sessions  uint32
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a server on a local port, it panics when it can not listen
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("tiberotest: failed to listen: %v", err))
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("tiberotest: failed to generate key: %v", err))
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic(fmt.Sprintf("tiberotest: failed to encode key: %v", err))
+	}
+	server := &Server{
+		listener:  listener,
+		key:       key,
+		pem:       pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		responses: map[string]*Response{},
+		passwords: map[string]string{},
+		expired:   map[string]bool{},
+		conns:     map[net.Conn]bool{},
+	}
+	// the statement of TConn.Ping
+	server.responses["SELECT 1 FROM DUAL"] = Rows([]Column{{Name: "1", Type: gibero.DT_NUMBER}}, []any{1})
+	server.wg.Add(1)
+	go server.serve()
+	return server
+}
+
+// Addr returns the host:port the server listens on
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// DSN returns a dsn connecting to the server as test/test
+func (server *Server) DSN() string {
+	return "tibero://test:test@" + server.Addr() + "/test"
+}
+
+// PublicKey returns the PEM public key sent in the public key exchange
+func (server *Server) PublicKey() []byte {
+	return server.pem
+}
+
+// On registers the response of sql, compared after trimming spaces
+func (server *Server) On(sql string, response *Response) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.responses[strings.TrimSpace(sql)] = response
+}
+
+// Handle answers the statements without a response registered with On,
+// they fail with ErrNoResponse otherwise
+func (server *Server) Handle(handler func(sql string) *Response) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.handler = handler
+}
+
+// SetPassword makes the logins of user check password, any credentials
+// are accepted while no password is set
+func (server *Server) SetPassword(user string, password string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.passwords[user] = password
+}
+
+// ExpirePassword refuses the logins of user with ErrPasswordExpired until
+// the driver changes the password
+func (server *Server) ExpirePassword(user string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.expired[user] = true
+}
+
+// SetFetchSize limits the rows sent per reply so the driver has to fetch
+// the rest, 0 sends every row with the execution
+func (server *Server) SetFetchSize(size int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.fetchSize = size
+}
+
+// Queries returns the statements received, in order
+func (server *Server) Queries() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string{}, server.queries...)
+}
+
+// Close stops the server and closes its connections
+func (server *Server) Close() error {
+	err := server.listener.Close()
+	server.mu.Lock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mu.Unlock()
+	server.wg.Wait()
+	return err
+}
+
+func (server *Server) serve() {
+	defer server.wg.Done()
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mu.Lock()
+		server.conns[conn] = true
+		server.sessions++
+		session := &session{server: server, conn: conn, id: server.sessions, cursors: map[uint32]*cursor{}}
+		server.mu.Unlock()
+		server.wg.Add(1)
+		go func() {
+			defer server.wg.Done()
+			session.run()
+			server.mu.Lock()
+			delete(server.conns, conn)
+			server.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (server *Server) response(sql string) *Response {
+	sql = strings.TrimSpace(sql)
+	server.mu.Lock()
+	server.queries = append(server.queries, sql)
+	response, ok := server.responses[sql]
+	handler := server.handler
+	server.mu.Unlock()
+	if ok {
+		return response
+	}
+	if handler != nil {
+		if response := handler(sql); response != nil {
+			return response
+		}
+	}
+	return Fail(ErrNoResponse, "tiberotest: no response for "+sql)
+}
+
+// login checks the credentials, it returns the error answered or nil
+func (server *Server) login(user string, password string) *Error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	expected, ok := server.passwords[user]
+	if ok && expected != password {
+		return &Error{Code: ErrLoginFailed, Message: "invalid username or password"}
+	}
+	if server.expired[user] {
+		return &Error{Code: ErrPasswordExpired, Message: "password expired"}
+	}
+	return nil
+}
+
+func (server *Server) changePassword(user string, password string, newPassword string) *Error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	expected, ok := server.passwords[user]
+	if ok && expected != password {
+		return &Error{Code: ErrLoginFailed, Message: "invalid username or password"}
+	}
+	server.passwords[user] = newPassword
+	delete(server.expired, user)
+	return nil
+}
+
+func (server *Server) decrypt(encoded string) (string, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	plain, err := gibero.DecryptWithPrivateKey(cipherText, server.key)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// cursor holds the rows of a result set not sent yet
+type cursor struct {
+	columns []Column
+	rows    [][]any
+}
+
+// session serves one connection
+type session struct {
+	server  *Server
+	conn    net.Conn
+	id      uint32
+	cursors map[uint32]*cursor
+	nextCsr uint32
+}
+
+func (s *session) run() {
+	reader := bufio.NewReader(s.conn)
+	writer := bufio.NewWriter(s.conn)
+	writer.Write(connectMessage())
+	writer.Flush()
+	for {
+		var head [16]byte
+		_, err := io.ReadFull(reader, head[:])
+		if err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(head[4:8]))
+		_, err = io.ReadFull(reader, body)
+		if err != nil {
+			return
+		}
+		writer.Write(s.reply(binary.BigEndian.Uint32(head[0:4]), body))
+		err = writer.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func connectMessage() []byte {
+	writer := gibero.CreateWriter()
+	for a := 0; a < 7; a++ {
+		writer.WriteBig32(0)
+	}
+	writer.WriteDBString("Tibero")
+	writer.WriteDBString("tiberotest")
+	for a := 0; a < 4; a++ {
+		writer.WriteBig32(0)
+	}
+	return message(msgConnect, writer.Data(), nil)
+}
+
+func (s *session) reply(code uint32, body []byte) []byte {
+	reader := newCommandReader(body)
+	switch code {
+	case cmdPKExchange:
+		writer := gibero.CreateWriter()
+		writer.WriteDBString(base64.StdEncoding.EncodeToString(s.server.pem))
+		return message(msgPKExchange, writer.Data(), nil)
+	case cmdAuth:
+		reader.Cur += 12
+		user, err := reader.string()
+		if err != nil {
+			return errorReply(ErrLoginFailed, err.Error())
+		}
+		reader.string()
+		encrypted, _ := reader.string()
+		password, err := s.server.decrypt(encrypted)
+		if err != nil {
+			return errorReply(ErrLoginFailed, "can not decrypt password: "+err.Error())
+		}
+		if fail := s.server.login(user, password); fail != nil {
+			return errorReply(fail.Code, fail.Message)
+		}
+		return s.sessionInfo()
+	case cmdChangePassword:
+		user, _ := reader.string()
+		encrypted, _ := reader.string()
+		encryptedNew, _ := reader.string()
+		password, err := s.server.decrypt(encrypted)
+		if err != nil {
+			return errorReply(ErrLoginFailed, "can not decrypt password: "+err.Error())
+		}
+		newPassword, err := s.server.decrypt(encryptedNew)
+		if err != nil {
+			return errorReply(ErrLoginFailed, "can not decrypt password: "+err.Error())
+		}
+		if fail := s.server.changePassword(user, password, newPassword); fail != nil {
+			return errorReply(fail.Code, fail.Message)
+		}
+		return s.sessionInfo()
+	case cmdSQL:
+		reader.uint32()
+		prefetch := reader.uint32()
+		sql, err := reader.string()
+		if err != nil {
+			return errorReply(ErrNoResponse, err.Error())
+		}
+		return s.execute(sql, prefetch > 0)
+	case cmdPrepareExecute:
+		sql, err := reader.string()
+		if err != nil {
+			return errorReply(ErrNoResponse, err.Error())
+		}
+		reader.uint32()
+		prefetch := reader.uint32()
+		return s.execute(sql, prefetch > 0)
+	case cmdBatch:
+		sql, err := reader.string()
+		if err != nil {
+			return errorReply(ErrNoResponse, err.Error())
+		}
+		reader.uint32()
+		reader.uint32()
+		rows := reader.uint32()
+		response := s.server.response(sql)
+		if response.Err != nil {
+			return errorReply(response.Err.Code, response.Err.Message)
+		}
+		counts := make([]int64, rows)
+		for a := range counts {
+			counts[a] = response.RowsAffected
+		}
+		return batchReply(counts)
+	case cmdFetch:
+		return s.fetch(reader.uint32())
+	case cmdCloseCursor:
+		delete(s.cursors, reader.uint32())
+		return okReply("")
+	case cmdCommit, cmdRollback, cmdCloseSession:
+		return okReply("")
+	}
+	return errorReply(ErrNoResponse, fmt.Sprintf("tiberotest: unsupported command %d", code))
+}
+
+func (s *session) sessionInfo() []byte {
+	writer := gibero.CreateWriter()
+	writer.WriteBig32(s.id)
+	writer.WriteBig32(1)
+	writer.WriteBig32(0)
+	return message(msgSessionInfo, writer.Data(), nil)
+}
+
+// execute answers sql with a result set when the driver prefetches rows,
+// with the affected count otherwise
+func (s *session) execute(sql string, query bool) []byte {
+	response := s.server.response(sql)
+	if response.Err != nil {
+		return errorReply(response.Err.Code, response.Err.Message)
+	}
+	if !query {
+		count := response.RowsAffected
+		if response.Columns != nil && count == 0 {
+			count = int64(len(response.Rows))
+		}
+		return countReply(count)
+	}
+	rows, completed := s.page(response.Rows)
+	s.nextCsr++
+	csrId := s.nextCsr
+	if !completed {
+		s.cursors[csrId] = &cursor{columns: response.Columns, rows: response.Rows[len(rows):]}
+	}
+	chunk, err := rowChunk(response.Columns, rows)
+	if err != nil {
+		return errorReply(ErrNoResponse, "tiberotest: "+err.Error())
+	}
+	writer := gibero.CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig32(0)
+	writer.WriteBig32(csrId)
+	writer.WriteBig32(uint32(len(response.Columns)))
+	writer.WriteBig32(0)
+	writer.WriteBig32(uint32(len(response.Columns)))
+	for _, column := range response.Columns {
+		writer.WriteDBString(column.Name)
+		writer.WriteBig32(column.Type)
+		for a := 0; a < 4; a++ {
+			writer.WriteBig32(0)
+		}
+	}
+	writer.WriteBig32(uint32(len(rows)))
+	writer.WriteBig32(flag(completed))
+	writer.WriteBig32(uint32(len(chunk)))
+	return message(msgPrefetch, writer.Data(), chunk)
+}
+
+func (s *session) fetch(csrId uint32) []byte {
+	cur, ok := s.cursors[csrId]
+	if !ok {
+		return errorReply(ErrNoResponse, fmt.Sprintf("tiberotest: no open cursor %d", csrId))
+	}
+	rows, completed := s.page(cur.rows)
+	cur.rows = cur.rows[len(rows):]
+	if completed {
+		delete(s.cursors, csrId)
+	}
+	chunk, err := rowChunk(cur.columns, rows)
+	if err != nil {
+		return errorReply(ErrNoResponse, "tiberotest: "+err.Error())
+	}
+	writer := gibero.CreateWriter()
+	writer.WriteBig32(uint32(len(rows)))
+	writer.WriteBig32(flag(completed))
+	writer.WriteBig32(uint32(len(chunk)))
+	return message(msgFetch, writer.Data(), chunk)
+}
+
+// page returns the rows of the next reply and whether they are the last ones
+func (s *session) page(rows [][]any) ([][]any, bool) {
+	s.server.mu.Lock()
+	size := s.server.fetchSize
+	s.server.mu.Unlock()
+	if size <= 0 || len(rows) <= size {
+		return rows, true
+	}
+	return rows[:size], false
+}
+
+func flag(val bool) uint32 {
+	if val {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package tiberotest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/sankooc/gibero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	assert := require.New(t)
+	server := NewServer()
+	defer server.Close()
+	created := time.Date(2023, 7, 21, 10, 15, 20, 0, time.Local)
+	server.On("SELECT ID, NAME, CREATED FROM USERS", Rows(
+		[]Column{{Name: "ID", Type: gibero.DT_NUMBER}, {Name: "NAME", Type: gibero.DT_VARCHAR}, {Name: "CREATED", Type: gibero.DT_TIMESTAMP}},
+		[]any{1, "alice", created},
+		[]any{2, nil, created},
+		[]any{3, "carol", nil},
+	))
+	server.SetFetchSize(2)
+	db, err := sql.Open("tibero", server.DSN())
+	assert.Nil(err)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT ID, NAME, CREATED FROM USERS")
+	assert.Nil(err)
+	columns, _ := rows.Columns()
+	assert.Equal([]string{"ID", "NAME", "CREATED"}, columns)
+	var ids []int64
+	var names []sql.NullString
+	var times []sql.NullTime
+	for rows.Next() {
+		var id int64
+		var name sql.NullString
+		var at sql.NullTime
+		assert.Nil(rows.Scan(&id, &name, &at))
+		ids = append(ids, id)
+		names = append(names, name)
+		times = append(times, at)
+	}
+	assert.Nil(rows.Err())
+	assert.Equal([]int64{1, 2, 3}, ids)
+	assert.Equal([]sql.NullString{{String: "alice", Valid: true}, {}, {String: "carol", Valid: true}}, names)
+	assert.True(created.Equal(times[0].Time))
+	assert.False(times[2].Valid)
+	assert.Equal([]string{"SELECT ID, NAME, CREATED FROM USERS"}, server.Queries())
+
+	// closing a partly read result closes its cursor on the server
+	rows, err = db.Query("SELECT ID, NAME, CREATED FROM USERS")
+	assert.Nil(err)
+	assert.True(rows.Next())
+	assert.Nil(rows.Close())
+	assert.Nil(db.Ping())
+}
+
+func TestBatch(t *testing.T) {
+	assert := require.New(t)
+	server := NewServer()
+	defer server.Close()
+	server.On("INSERT INTO NUMS VALUES (?)", Exec(1))
+	db, err := sql.Open("tibero", server.DSN())
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	assert.Nil(err)
+	defer conn.Close()
+	err = conn.Raw(func(dc any) error {
+		batch := gibero.NewBatch("INSERT INTO NUMS VALUES (?)")
+		batch.Add(1)
+		batch.Add(2)
+		res, err := dc.(*gibero.TConn).ExecBatch(batch)
+		if err != nil {
+			return err
+		}
+		assert.Equal([]int64{1, 1}, res.RowsAffected)
+		return res.Err()
+	})
+	assert.Nil(err)
+}
+
+func TestExecAndErrors(t *testing.T) {
+	assert := require.New(t)
+	server := NewServer()
+	defer server.Close()
+	server.On("UPDATE USERS SET NAME = ?", Exec(3))
+	server.On("DELETE FROM LOCKED", Fail(1234, "resource busy"))
+	server.Handle(func(sql string) *Response {
+		if sql == "INSERT INTO AUDIT VALUES (?)" {
+			return Exec(1)
+		}
+		return nil
+	})
+	db, err := sql.Open("tibero", server.DSN())
+	assert.Nil(err)
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE USERS SET NAME = ?", "bob")
+	assert.Nil(err)
+	count, _ := result.RowsAffected()
+	assert.Equal(int64(3), count)
+	_, err = db.Exec("DELETE FROM LOCKED")
+	assert.EqualError(err, "TBR-1234: resource busy")
+	tx, err := db.Begin()
+	assert.Nil(err)
+	_, err = tx.Exec("INSERT INTO AUDIT VALUES (?)", 1)
+	assert.Nil(err)
+	assert.Nil(tx.Commit())
+	_, err = db.Exec("DROP TABLE USERS")
+	assert.EqualError(err, "TBR-90001: tiberotest: no response for DROP TABLE USERS")
+	assert.Nil(db.Ping())
+}
+
+func TestLogin(t *testing.T) {
+	assert := require.New(t)
+	server := NewServer()
+	defer server.Close()
+	server.SetPassword("test", "secret")
+	db, err := sql.Open("tibero", server.DSN())
+	assert.Nil(err)
+	defer db.Close()
+	err = db.Ping()
+	assert.EqualError(err, "TBR-17001: invalid username or password")
+
+	server.SetPassword("test", "test")
+	server.ExpirePassword("test")
+	connector, err := gibero.NewConnector(server.DSN())
+	assert.Nil(err)
+	_, err = connector.Connect(context.Background())
+	assert.True(gibero.IsPasswordExpired(err))
+	connector.SetPasswordChangeHandler(func(ctx context.Context, username string) (string, error) {
+		return "renewed", nil
+	})
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(err)
+	conn.Close()
+	server.SetPassword("test", "renewed")
+	conn, err = connector.Connect(context.Background())
+	assert.Nil(err)
+	conn.Close()
+}
+
+func TestCommandReader(t *testing.T) {
+	assert := require.New(t)
+	writer := gibero.CreateWriter()
+	writer.WriteDBString("SELECT 1 FROM DUAL")
+	str, err := newCommandReader(writer.Data()).string()
+	assert.Nil(err)
+	assert.Equal("SELECT 1 FROM DUAL", str)
+	_, err = newCommandReader(writer.Data()[:10]).string()
+	assert.ErrorIs(err, gibero.ErrMalformedMessage)
+}
@@ -0,0 +1,191 @@
+package tiberotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/sankooc/gibero"
+)
+
+// message types of the replies
+const (
+	msgConnect     = 0
+	msgSessionInfo = 2
+	msgPrefetch    = 11
+	msgFetch       = 12
+	msgCount       = 13
+	msgBatch       = 16
+	msgOk          = 75
+	msgError       = 76
+	msgPKExchange  = 283
+)
+
+// command codes of the driver
+const (
+	cmdSQL            = 6
+	cmdPrepareExecute = 7
+	cmdFetch          = 8
+	cmdBatch          = 15
+	cmdCloseCursor    = 22
+	cmdCommit         = 23
+	cmdRollback       = 24
+	cmdCloseSession   = 28
+	cmdAuth           = 137
+	cmdChangePassword = 138
+	cmdPKExchange     = 282
+)
+
+// message frames a reply: type, body size, tsn, then the body and the
+// bytes the driver reads after the body such as row chunks
+func message(msgType uint32, body []byte, extra []byte) []byte {
+	data := make([]byte, 16, 16+len(body)+len(extra))
+	binary.BigEndian.PutUint32(data[0:4], msgType)
+	binary.BigEndian.PutUint32(data[4:8], uint32(len(body)))
+	return append(append(data, body...), extra...)
+}
+
+// commandReader reads the body of a command
+type commandReader struct {
+	*gibero.ByteReader
+}
+
+func newCommandReader(body []byte) *commandReader {
+	return &commandReader{gibero.CreateReader(nil, body, 0)}
+}
+
+func (r *commandReader) uint32() uint32 {
+	if int(r.Cur)+4 > len(r.Data) {
+		r.Cur = uint32(len(r.Data))
+		return 0
+	}
+	val := binary.BigEndian.Uint32(r.Data[r.Cur:])
+	r.Cur += 4
+	return val
+}
+
+func (r *commandReader) string() (string, error) {
+	str := r.ReadDBString()
+	if err := r.Err(); err != nil {
+		return "", fmt.Errorf("truncated command: %w", err)
+	}
+	return str, nil
+}
+
+func okReply(warning string) []byte {
+	writer := gibero.CreateWriter()
+	writer.WriteDBString(warning)
+	return message(msgOk, writer.Data(), nil)
+}
+
+func countReply(count int64) []byte {
+	writer := gibero.CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig64(uint64(count))
+	return message(msgCount, writer.Data(), nil)
+}
+
+func errorReply(code int, reason string) []byte {
+	writer := gibero.CreateWriter()
+	writer.WriteBig32(0)
+	writer.WriteBig32(1)
+	writer.WriteBig64(0)
+	writer.WriteBig32(1)
+	writer.WriteBig32(0)
+	exception := make([]byte, 12+4+9+6+712+5+8+96+84)
+	binary.BigEndian.PutUint32(exception[12:16], uint32(int32(-code)))
+	copy(exception[25:31], "HY000 ")
+	copy(exception[31:743], bytes.Repeat([]byte(" "), 712))
+	copy(exception[31:743], reason)
+	return message(msgError, append(writer.Data(), exception...), nil)
+}
+
+func batchReply(counts []int64) []byte {
+	writer := gibero.CreateWriter()
+	writer.WriteBig64(0)
+	writer.WriteBig32(uint32(len(counts)))
+	for _, count := range counts {
+		writer.WriteBig64(uint64(count))
+	}
+	writer.WriteBig32(0)
+	return message(msgBatch, writer.Data(), nil)
+}
+
+// rowChunk encodes rows the way the driver reads a prefetch or fetch chunk
+func rowChunk(columns []Column, rows [][]any) ([]byte, error) {
+	chunk := []byte{0}
+	for index, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d values for %d columns", index, len(row), len(columns))
+		}
+		chunk = append(chunk, 0, 0, 0)
+		for a, val := range row {
+			data, err := encodeValue(columns[a].Type, val)
+			if err != nil {
+				return nil, fmt.Errorf("row %d column %s: %w", index, columns[a].Name, err)
+			}
+			if len(data) <= 250 {
+				chunk = append(chunk, byte(len(data)))
+			} else {
+				chunk = append(chunk, 0xfe, byte(len(data)>>8), byte(len(data)))
+			}
+			chunk = append(chunk, data...)
+		}
+	}
+	return append(chunk, 0), nil
+}
+
+// encodeValue returns the wire form of val for a column of type dtype,
+// nil is sent as NULL
+func encodeValue(dtype uint32, val any) ([]byte, error) {
+	if val == nil {
+		return nil, nil
+	}
+	switch dtype {
+	case gibero.DT_NUMBER:
+		switch v := val.(type) {
+		case int:
+			return gibero.EncodeInt64(int64(v)), nil
+		case int32:
+			return gibero.EncodeInt64(int64(v)), nil
+		case int64:
+			return gibero.EncodeInt64(v), nil
+		case uint64:
+			return gibero.EncodeUint64(v), nil
+		case float64:
+			return gibero.EncodeFloat(v, 64)
+		case bool:
+			if v {
+				return gibero.EncodeInt64(1), nil
+			}
+			return gibero.EncodeInt64(0), nil
+		}
+	case gibero.DT_CHAR, gibero.DT_VARCHAR, gibero.DT_NCHAR, gibero.DT_NVARCHAR, gibero.DT_LONG:
+		if v, ok := val.(string); ok {
+			return []byte(v), nil
+		}
+	case gibero.DT_RAW:
+		if v, ok := val.([]byte); ok {
+			return v, nil
+		}
+	case gibero.DT_DATE:
+		if v, ok := val.(time.Time); ok {
+			return gibero.EncodeDate(v), nil
+		}
+	case gibero.DT_TIMESTAMP:
+		if v, ok := val.(time.Time); ok {
+			return gibero.EncodeTimestamp(v), nil
+		}
+	case gibero.DT_BOOLEAN:
+		if v, ok := val.(bool); ok {
+			if v {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", dtype)
+	}
+	return nil, fmt.Errorf("unsupported value %T for column type %d", val, dtype)
+}
@@ -0,0 +1,141 @@
+package gibero
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// ssl modes selected with the `sslmode` dsn parameter
+const (
+	// plain connection
+	SSL_DISABLE = "disable"
+	// TLS when the server supports it, plain otherwise
+	SSL_PREFER = "prefer"
+	// TLS without verifying the server certificate, as verify-ca when
+	// sslrootcert is set
+	SSL_REQUIRE = "require"
+	// TLS verifying the certificate chain but not the host name
+	SSL_VERIFY_CA = "verify-ca"
+	// TLS verifying the certificate chain and the host name
+	SSL_VERIFY_FULL = "verify-full"
+)
+
+// tlsUpgrader is implemented by servers able to switch the established
+// connection to TLS
+type tlsUpgrader interface {
+	startTLS(config *tls.Config) error
+}
+
+// loadTLS builds the tls configuration of the ssl dsn parameters
+func (dsn *TiberoDSN) loadTLS() error {
+	switch dsn.sslMode {
+	case SSL_DISABLE:
+		return nil
+	case SSL_PREFER, SSL_REQUIRE, SSL_VERIFY_CA, SSL_VERIFY_FULL:
+	default:
+		return fmt.Errorf("invalid sslmode %q", dsn.sslMode)
+	}
+	config := &tls.Config{ServerName: dsn.sslServerName}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(dsn.address)
+		if err == nil {
+			config.ServerName = host
+		}
+	}
+	if dsn.sslRootCert != "" {
+		data, err := os.ReadFile(dsn.sslRootCert)
+		if err != nil {
+			return fmt.Errorf("sslrootcert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("sslrootcert: no certificate found in %s", dsn.sslRootCert)
+		}
+		config.RootCAs = pool
+	}
+	if dsn.sslCert != "" || dsn.sslKey != "" {
+		if dsn.sslCert == "" || dsn.sslKey == "" {
+			return errors.New("sslcert and sslkey must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(dsn.sslCert, dsn.sslKey)
+		if err != nil {
+			return fmt.Errorf("sslcert: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	mode := dsn.sslMode
+	if mode == SSL_REQUIRE && dsn.sslRootCert != "" {
+		// as libpq, a root certificate given with require verifies the chain
+		mode = SSL_VERIFY_CA
+	}
+	switch mode {
+	case SSL_PREFER, SSL_REQUIRE:
+		config.InsecureSkipVerify = true
+	case SSL_VERIFY_CA:
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+	}
+	dsn.tlsConfig = config
+	return nil
+}
+
+// verifyChain checks the server certificate against roots ignoring its host name
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for a, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[a] = cert
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// negotiateTLS switches the connection to TLS when the sslmode asks for it
+// and the server announced the capability in its connect message
+func (tibero *Tibero) negotiateTLS() error {
+	dsn := tibero.dsn
+	if dsn.sslMode == SSL_DISABLE || dsn.tlsConfig == nil {
+		return nil
+	}
+	if tibero.connectInfo.flags&CONNECT_FLAG_SSL == 0 {
+		if dsn.sslMode == SSL_PREFER {
+			tibero.logger.Warn("server does not support SSL, continue in plain text")
+			return nil
+		}
+		return errors.New("server does not support SSL connections")
+	}
+	upgrader, ok := tibero.DBServer.(tlsUpgrader)
+	if !ok {
+		return fmt.Errorf("%T can not start TLS", tibero.DBServer)
+	}
+	tibero.logger.Debug("start tls", "serverName", dsn.tlsConfig.ServerName)
+	msg, err := tibero.write(SSLRequestCMD())
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*OkReply); !ok {
+		return unexpectedReply(msg)
+	}
+	err = upgrader.startTLS(dsn.tlsConfig)
+	if err != nil {
+		tibero.broken = true
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	return nil
+}
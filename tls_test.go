@@ -0,0 +1,164 @@
+package gibero
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned creates a certificate for 127.0.0.1 and returns it with its pem form
+func selfSigned(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tibero"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"tibero.local"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func connectReply(flags uint32) []byte {
+	writer := CreateWriter()
+	for a := 0; a < 7; a++ {
+		writer.WriteBig32(0)
+	}
+	writer.WriteDBString("Tibero")
+	writer.WriteDBString("7")
+	writer.WriteBig32(0)
+	writer.WriteBig32(0)
+	writer.WriteBig32(0)
+	writer.WriteBig32(flags)
+	body := writer.Data()
+	return append(header(0, uint32(len(body))), body...)
+}
+
+func okReply(warning string) []byte {
+	writer := CreateWriter()
+	writer.WriteDBString(warning)
+	body := writer.Data()
+	return append(header(75, uint32(len(body))), body...)
+}
+
+// serveTLS stands in for a server accepting TLS: it sends the connect message,
+// answers the ssl request, runs the handshake and answers one command over TLS
+func serveTLS(t *testing.T, cert tls.Certificate) *net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(connectReply(CONNECT_FLAG_SSL))
+		request := make([]byte, 16)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		conn.Write(okReply(""))
+		secure := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err := secure.Handshake(); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(secure, request); err != nil {
+			return
+		}
+		secure.Write(okReply("secure"))
+	}()
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func dialTLS(t *testing.T, dsn *TiberoDSN, addr *net.TCPAddr) (*Tibero, error) {
+	tibero := &Tibero{DBServer: &Singleton{TiberoDSN: dsn, addr: addr}, dsn: dsn}
+	require.Nil(t, tibero.DBServer.Connect(context.Background()))
+	t.Cleanup(func() { tibero.DBServer.close() })
+	msg, err := tibero.readReply()
+	require.Nil(t, err)
+	tibero.connectInfo = msg.(*ConnectMessage)
+	return tibero, tibero.negotiateTLS()
+}
+
+func TestTLSConnect(t *testing.T) {
+	assert := require.New(t)
+	cert, certPEM := selfSigned(t)
+	rootCert := filepath.Join(t.TempDir(), "root.pem")
+	assert.Nil(os.WriteFile(rootCert, certPEM, 0600))
+
+	for _, mode := range []string{SSL_REQUIRE, SSL_VERIFY_CA, SSL_VERIFY_FULL} {
+		addr := serveTLS(t, cert)
+		conf := DsnConvert("tibero://u:p@" + addr.String() + "/db?sslmode=" + mode + "&sslrootcert=" + rootCert)
+		assert.Nil(conf.loadTLS())
+		tibero, err := dialTLS(t, conf, addr)
+		assert.Nil(err, mode)
+		msg, err := tibero.commit()
+		assert.Nil(err)
+		assert.Equal("secure", msg.(*OkReply).warningMsg)
+	}
+
+	addr := serveTLS(t, cert)
+	conf := DsnConvert("tibero://u:p@" + addr.String() + "/db?sslmode=verify-full&sslservername=other.local&sslrootcert=" + rootCert)
+	assert.Nil(conf.loadTLS())
+	_, err := dialTLS(t, conf, addr)
+	assert.NotNil(err)
+
+	addr = serveTLS(t, cert)
+	conf = DsnConvert("tibero://u:p@" + addr.String() + "/db?sslmode=verify-ca")
+	assert.Nil(conf.loadTLS())
+	_, err = dialTLS(t, conf, addr)
+	assert.NotNil(err)
+
+	// require verifies the chain only when a root certificate is given
+	_, otherPEM := selfSigned(t)
+	otherCert := filepath.Join(t.TempDir(), "other.pem")
+	assert.Nil(os.WriteFile(otherCert, otherPEM, 0600))
+	addr = serveTLS(t, cert)
+	conf = DsnConvert("tibero://u:p@" + addr.String() + "/db?sslmode=require&sslrootcert=" + otherCert)
+	assert.Nil(conf.loadTLS())
+	_, err = dialTLS(t, conf, addr)
+	assert.NotNil(err)
+	addr = serveTLS(t, cert)
+	conf = DsnConvert("tibero://u:p@" + addr.String() + "/db?sslmode=require")
+	assert.Nil(conf.loadTLS())
+	_, err = dialTLS(t, conf, addr)
+	assert.Nil(err)
+}
+
+func TestTLSNotSupported(t *testing.T) {
+	assert := require.New(t)
+	tibero := &Tibero{DBServer: &okServer{}, connectInfo: &ConnectMessage{}}
+	tibero.dsn = DsnConvert("tibero://u:p@127.0.0.1:8629/db?sslmode=prefer")
+	assert.Nil(tibero.dsn.loadTLS())
+	assert.Nil(tibero.negotiateTLS())
+	tibero.dsn = DsnConvert("tibero://u:p@127.0.0.1:8629/db?sslmode=require")
+	assert.Nil(tibero.dsn.loadTLS())
+	assert.NotNil(tibero.negotiateTLS())
+
+	assert.NotNil(DsnConvert("tibero://u:p@127.0.0.1:8629/db?sslmode=always").loadTLS())
+	assert.NotNil(DsnConvert("tibero://u:p@127.0.0.1:8629/db?sslmode=require&sslcert=client.pem").loadTLS())
+}
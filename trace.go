@@ -0,0 +1,407 @@
+package gibero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// TraceDirection tells whether a traced message was sent or received
+type TraceDirection byte
+
+const (
+	TraceSent     TraceDirection = '>'
+	TraceReceived TraceDirection = '<'
+)
+
+// trace files start with traceMagic, then hold the records one after the
+// other: direction (1), unix time in nanoseconds (8), size (4) and the message
+const traceMagic = "GIBEROTR"
+
+// TraceRecord is one message of a trace. Data holds the 16 byte header and
+// the body, for received messages followed by the row chunks read with it.
+type TraceRecord struct {
+	Direction TraceDirection
+	Time      time.Time
+	MsgType   uint32
+	Tsn       uint64
+	Data      []byte
+}
+
+// TraceSink opens the trace of the physical connection connID
+type TraceSink func(connID uint64) (io.WriteCloser, error)
+
+// TraceDir returns a TraceSink writing the trace of every connection to
+// its own file in dir, readable by the owner only
+func TraceDir(dir string) TraceSink {
+	return func(connID uint64) (io.WriteCloser, error) {
+		name := fmt.Sprintf("gibero-%s-%d.trace", time.Now().Format("20060102-150405"), connID)
+		return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+}
+
+// SetTraceSink records every message of the new connections to the
+// writer returned by sink, see the gibero-trace command to read them.
+// Traces are sensitive: they hold the login with the encrypted password,
+// the SQL text, bind values and fetched rows.
+func (connector *TConnector) SetTraceSink(sink TraceSink) {
+	connector.traceSink = sink
+}
+
+// startTrace records the messages of the connection, a sink failure only
+// disables the trace
+func (tibero *Tibero) startTrace(sink TraceSink, connID uint64) {
+	w, err := sink(connID)
+	if err != nil {
+		tibero.logger.Warn("trace disabled", "error", err)
+		return
+	}
+	trace, err := NewTraceWriter(w)
+	if err != nil {
+		w.Close()
+		tibero.logger.Warn("trace disabled", "error", err)
+		return
+	}
+	recorder := NewRecorder(tibero.DBServer, trace)
+	recorder.logger = tibero.logger
+	tibero.DBServer = recorder
+}
+
+// TraceWriter records messages in the trace format
+type TraceWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// first write error, tracing stops after it
+	err error
+}
+
+func NewTraceWriter(w io.Writer) (*TraceWriter, error) {
+	_, err := io.WriteString(w, traceMagic)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceWriter{w: w}, nil
+}
+
+// Record appends a message to the trace
+func (tw *TraceWriter) Record(direction TraceDirection, at time.Time, data []byte) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.err != nil {
+		return tw.err
+	}
+	var head [13]byte
+	head[0] = byte(direction)
+	binary.BigEndian.PutUint64(head[1:9], uint64(at.UnixNano()))
+	binary.BigEndian.PutUint32(head[9:13], uint32(len(data)))
+	_, tw.err = tw.w.Write(head[:])
+	if tw.err == nil {
+		_, tw.err = tw.w.Write(data)
+	}
+	return tw.err
+}
+
+// Close closes the underlying writer when it is an io.Closer
+func (tw *TraceWriter) Close() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if closer, ok := tw.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// TraceReader reads the records of a trace
+type TraceReader struct {
+	r io.Reader
+}
+
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	magic := make([]byte, len(traceMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != traceMagic {
+		return nil, errors.New("not a gibero trace")
+	}
+	return &TraceReader{r: r}, nil
+}
+
+// Next returns the next record, io.EOF after the last one
+func (tr *TraceReader) Next() (*TraceRecord, error) {
+	var head [13]byte
+	_, err := io.ReadFull(tr.r, head[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated trace record: %w", err)
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[9:13])
+	if size > MAX_MESSAGE_SIZE {
+		return nil, fmt.Errorf("trace record of %d bytes is more than the %d bytes limit", size, MAX_MESSAGE_SIZE)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(tr.r, data)
+	if err != nil {
+		return nil, fmt.Errorf("truncated trace record: %w", io.ErrUnexpectedEOF)
+	}
+	record := &TraceRecord{
+		Direction: TraceDirection(head[0]),
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(head[1:9]))),
+		Data:      data,
+	}
+	if len(data) >= 16 {
+		meta := &Message{}
+		meta.DeserializeFromBytes(data)
+		record.MsgType = meta.MsgType
+		record.Tsn = meta.Tsn
+	}
+	return record, nil
+}
+
+var commandNames = map[Tibero_CMD_CODE]string{
+	5: "EXECUTE", 6: "SQL", 7: "PREPARE_EXECUTE", 8: "FETCH", 15: "BATCH",
+	CLOSE_CSR: "CLOSE_CSR", 23: "COMMIT", 24: "ROLLBACK", CLOSE_SESSION: "CLOSE_SESSION",
+	CLOSE_LOB: "CLOSE_LOB", XA_START: "XA_START", XA_END: "XA_END", XA_PREPARE: "XA_PREPARE",
+	XA_COMMIT: "XA_COMMIT", XA_ROLLBACK: "XA_ROLLBACK", XA_FORGET: "XA_FORGET",
+	XA_RECOVER: "XA_RECOVER", CLOSE_XA: "CLOSE_XA", AUTH: "AUTH", CHANGE_PASSWD: "CHANGE_PASSWD",
+	CLOSE_TID: "CLOSE_TID", 282: "PK_EXCHANGE", SSL_REQUEST: "SSL_REQUEST",
+}
+
+func (code Tibero_CMD_CODE) String() string {
+	if name, ok := commandNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("CMD(%d)", uint32(code))
+}
+
+// Describe decodes the record into a readable line
+func (record *TraceRecord) Describe() string {
+	if len(record.Data) < 16 {
+		return fmt.Sprintf("%c truncated message %s", record.Direction, hex.EncodeToString(record.Data))
+	}
+	head := fmt.Sprintf("%c tsn=%d size=%d", record.Direction, record.Tsn, len(record.Data))
+	if record.Direction == TraceSent {
+		return head + " " + describeCommand(record.Data)
+	}
+	return head + " " + describeReply(record.Data)
+}
+
+func describeCommand(data []byte) string {
+	code := Tibero_CMD_CODE(binary.BigEndian.Uint32(data))
+	offset := -1
+	switch code {
+	case 7, 15:
+		offset = 16
+	case 6:
+		offset = 24
+	}
+	if offset < 0 || offset+4 > len(data) {
+		return code.String()
+	}
+	reader := CreateReader(nil, data, offset)
+	size := reader.read32Big()
+	if uint64(offset)+4+uint64(size) > uint64(len(data)) {
+		return code.String()
+	}
+	return fmt.Sprintf("%s sql=%q", code, reader.read32String(size))
+}
+
+func describeReply(data []byte) string {
+	meta, err := parseHeader(data)
+	if err != nil {
+		return err.Error()
+	}
+	decoder, ok := lookupMessage(meta.MsgType)
+	if !ok {
+		return fmt.Sprintf("unknown message type %d", meta.MsgType)
+	}
+	end := 16 + uint64(meta.MsgBodySize)
+	if end > uint64(len(data)) {
+		return fmt.Sprintf("message type %d truncated", meta.MsgType)
+	}
+	msg := decoder.create(meta)
+	reader := CreateReader(bytes.NewReader(data[end:]), data[16:end], 0)
+	msg.deserialize(reader)
+	name := strings.TrimPrefix(fmt.Sprintf("%T", msg), "*gibero.")
+	if reader.Err() != nil {
+		return fmt.Sprintf("%s malformed: %v", name, reader.Err())
+	}
+	if d, ok := msg.(describer); ok {
+		return name + " {" + d.describe() + "}"
+	}
+	return name
+}
+
+// describer renders the decoded fields of a reply for the trace
+type describer interface {
+	describe() string
+}
+
+// formatBytes renders data as a string when it is readable text, in hex otherwise
+func formatBytes(data []byte) string {
+	if utf8.Valid(data) && !bytes.ContainsAny(data, "\x00") {
+		return fmt.Sprintf("%q", data)
+	}
+	if len(data) > 64 {
+		return hex.EncodeToString(data[:64]) + "..."
+	}
+	return hex.EncodeToString(data)
+}
+
+// formatValue renders a value decoded by readDBValue
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case []byte:
+		return formatBytes(v)
+	case string:
+		return fmt.Sprintf("%q", v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return "nil"
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// formatValues renders values, the first 20 of them
+func formatValues(values []interface{}) string {
+	items := []string{}
+	for a, value := range values {
+		if a == 20 {
+			items = append(items, fmt.Sprintf("... %d more", len(values)-a))
+			break
+		}
+		items = append(items, formatValue(value))
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func formatPpid(ppid *[8]byte) string {
+	if ppid == nil {
+		return "nil"
+	}
+	return hex.EncodeToString(ppid[:])
+}
+
+func formatDBByte32(data *DBByte32) string {
+	if data == nil {
+		return "nil"
+	}
+	return formatBytes(*data)
+}
+
+func (msg *ConnectMessage) describe() string {
+	return fmt.Sprintf("protocol=%d.%d charset=%d ncharset=%d product=%s version=%s tbVersion=%d.%d flags=%d",
+		msg.protocolMajor, msg.protocolMinor, msg.charset, msg.ncharset,
+		formatDBByte32(msg.tbProductName), formatDBByte32(msg.tbProductVersion), msg.tbMajor, msg.tbMinor, msg.flags)
+}
+
+func (msg *SessionInfoMessage) describe() string {
+	params := []string{}
+	for _, param := range msg.nlsData {
+		params = append(params, fmt.Sprintf("%d:%q", param.ClntParamId, param.ClntParamVal))
+	}
+	return fmt.Sprintf("sessionId=%d serialNo=%d nlsData=[%s]", msg.sessionId, msg.serialNo, strings.Join(params, " "))
+}
+
+func (msg *PKExchangeMessage) describe() string {
+	return "SessKey=" + formatDBByte32(msg.SessKey)
+}
+
+func (msg *NoticeMessage) describe() string {
+	return fmt.Sprintf("code=%d text=%q", msg.code, msg.text)
+}
+
+func (msg *OkReply) describe() string {
+	return fmt.Sprintf("warningMsg=%q", msg.warningMsg)
+}
+
+func (msg *TbMsgExecuteCountReply) describe() string {
+	return fmt.Sprintf("ppid=%s count=%d", formatPpid(msg.ppid), msg.count())
+}
+
+func (msg *TbMsgExecutePsmReply) describe() string {
+	return msg.TbMsgExecuteCountReply.describe() + " outParams=" + formatValues(msg.outParams)
+}
+
+func (msg *TbMsgExecuteReturningReply) describe() string {
+	params := []string{}
+	for _, rows := range msg.returnParams {
+		params = append(params, formatValues(rows))
+	}
+	return msg.TbMsgExecuteCountReply.describe() + " returnParams=[" + strings.Join(params, " ") + "]"
+}
+
+func (msg *TbMsgFetchReply) describe() string {
+	return fmt.Sprintf("rowCnt=%d isFetchCompleted=%d rowChunkSize=%d rowChunk=%s",
+		msg.rowCnt, msg.isFetchCompleted, msg.rowChunkSize, formatBytes(msg.rowChunk))
+}
+
+func (msg *TbMsgExecutePrefetchReply) describe() string {
+	columns := []string{}
+	for _, desc := range msg.colMeta {
+		columns = append(columns, fmt.Sprintf("%s:%d", desc.name, desc.dataType))
+	}
+	rows := []string{}
+	for a, row := range msg.resultSet {
+		if a == 20 {
+			rows = append(rows, fmt.Sprintf("... %d more", len(msg.resultSet)-a))
+			break
+		}
+		rows = append(rows, formatValues(row.values))
+	}
+	return fmt.Sprintf("ppid=%s affectedCnt=%d csrId=%d columns=[%s] rowCnt=%d isFetchCompleted=%d rows=[%s]",
+		formatPpid(msg.ppid), msg.affectedCnt, msg.csrId, strings.Join(columns, " "),
+		msg.rowCnt, msg.isFetchCompleted, strings.Join(rows, " "))
+}
+
+func (msg *TbMsgBatchUpdateReply) describe() string {
+	rows := make([]int, 0, len(msg.errors))
+	for row := range msg.errors {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+	errs := []string{}
+	for _, row := range rows {
+		errs = append(errs, fmt.Sprintf("%d:%q", row, msg.errors[row].Error()))
+	}
+	return fmt.Sprintf("ppid=%s counts=%v errors=[%s]", formatPpid(msg.ppid), msg.counts, strings.Join(errs, " "))
+}
+
+func (msg *TbMsgXaReply) describe() string {
+	return fmt.Sprintf("rc=%d", msg.rc)
+}
+
+func (msg *TbMsgXaRecoverReply) describe() string {
+	xids := []string{}
+	for _, xid := range msg.xids {
+		xids = append(xids, fmt.Sprintf("%d:%s:%s", xid.FormatID, formatBytes(xid.GlobalTransactionID), formatBytes(xid.BranchQualifier)))
+	}
+	return "xids=[" + strings.Join(xids, " ") + "]"
+}
+
+func (msg *EReply) describe() string {
+	if msg.noError {
+		return fmt.Sprintf("flag=%d noError=true", msg.flag)
+	}
+	errs := []string{}
+	for _, e := range msg.exceptions {
+		errs = append(errs, fmt.Sprintf("%q", e.Error()))
+	}
+	return fmt.Sprintf("flag=%d exceptions=[%s]", msg.flag, strings.Join(errs, " "))
+}
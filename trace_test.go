@@ -0,0 +1,105 @@
+package gibero
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type traceBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (buf *traceBuffer) Close() error {
+	buf.closed = true
+	return nil
+}
+
+func TestTrace(t *testing.T) {
+	assert := require.New(t)
+	fetch := CreateWriter()
+	fetch.WriteBig32(1)
+	fetch.WriteBig32(1)
+	fetch.WriteBig32(4)
+	body := fetch.Data()
+	chunk := []byte{0xde, 0xad, 0xbe, 0xef}
+	addr := serve(t, okReply("traced"), append(append(header(12, uint32(len(body))), body...), chunk...))
+
+	buf := &traceBuffer{}
+	tibero := &Tibero{DBServer: &Singleton{addr: addr}, dsn: &TiberoDSN{}}
+	tibero.startTrace(func(connID uint64) (io.WriteCloser, error) { return buf, nil }, 1)
+	assert.Nil(tibero.DBServer.Connect(context.Background()))
+	_, err := tibero.commit()
+	assert.Nil(err)
+	_, err = tibero.executeDirct("select 1 from dual")
+	assert.Nil(err)
+	assert.Nil(tibero.DBServer.close())
+	assert.True(buf.closed)
+
+	reader, err := NewTraceReader(&buf.Buffer)
+	assert.Nil(err)
+	var lines []string
+	var records []*TraceRecord
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(err)
+		records = append(records, record)
+		lines = append(lines, record.Describe())
+	}
+	assert.Len(records, 4)
+	assert.Equal([]string{
+		"> tsn=0 size=16 COMMIT",
+		`< tsn=0 size=28 OkReply {warningMsg="traced"}`,
+		`> tsn=0 size=48 SQL sql="select 1 from dual"`,
+		"< tsn=0 size=32 TbMsgFetchReply {rowCnt=1 isFetchCompleted=1 rowChunkSize=4 rowChunk=deadbeef}",
+	}, lines)
+	assert.Equal(uint32(12), records[3].MsgType)
+	assert.True(bytes.HasSuffix(records[3].Data, chunk))
+
+	_, err = NewTraceReader(strings.NewReader("not a trace"))
+	assert.NotNil(err)
+	assert.Equal("CMD(9999)", Tibero_CMD_CODE(9999).String())
+}
+
+func TestDescribeReply(t *testing.T) {
+	assert := require.New(t)
+	reply := func(msgType uint32, body []byte) []byte {
+		return append(header(msgType, uint32(len(body))), body...)
+	}
+	xa := CreateWriter()
+	xa.WriteBig32(0xfffffffc)
+	notice := CreateWriter()
+	notice.WriteBig32(7)
+	notice.WriteDBString("compiled")
+	xids := CreateWriter()
+	xids.WriteBig32(1)
+	(&Xid{FormatID: 1, GlobalTransactionID: []byte("g1"), BranchQualifier: []byte{0xff}}).serialize(xids)
+	assert.Equal("TbMsgXaReply {rc=-4}", describeReply(reply(68, xa.Data())))
+	assert.Equal(`NoticeMessage {code=7 text="compiled"}`, describeReply(reply(77, notice.Data())))
+	assert.Equal(`TbMsgXaRecoverReply {xids=[1:"g1":ff]}`, describeReply(reply(69, xids.Data())))
+	assert.Equal("TbMsgXaReply malformed: malformed message: 4 bytes needed at offset 0 of 1", describeReply(reply(68, []byte{1})))
+	assert.Equal("unknown message type 9999", describeReply(reply(9999, nil)))
+}
+
+func TestTraceDir(t *testing.T) {
+	assert := require.New(t)
+	dir := t.TempDir()
+	w, err := TraceDir(dir)(1)
+	assert.Nil(err)
+	assert.Nil(w.Close())
+	files, err := os.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(files, 1)
+	info, err := files[0].Info()
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+}
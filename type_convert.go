@@ -133,7 +133,6 @@ func FromNumber(inputData []byte) (mantissa uint64, negative bool, exponent int,
 	}
 	// exponent = -4
 	exponent = exponent*2 - mantissaDigits // Adjust exponent to the retrieved mantissa
-	printFormat("decode exponent [%d]\n", exponent)
 	return mantissa, negative, exponent, mantissaDigits + firstDigitWasZero, nil
 }
 
@@ -163,6 +162,20 @@ func EncodeUint64(val uint64) []byte {
 	return ToNumber(mantissa, false, exponent)
 }
 
+// EncodeTimestamp returns the 12 bytes TIMESTAMP form of ti
+func EncodeTimestamp(ti time.Time) []byte {
+	ret := make([]byte, 12)
+	fromTimestamp(ret, &ti)
+	return ret
+}
+
+// EncodeDate returns the 8 bytes DATE form of ti, without the time of day
+func EncodeDate(ti time.Time) []byte {
+	ret := make([]byte, 8)
+	fromDate(ret, &ti)
+	return ret
+}
+
 func EncodeInt(val int) []byte {
 	return EncodeInt64(int64(val))
 }
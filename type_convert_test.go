@@ -1,7 +1,9 @@
 package gibero
 
 import (
+	"database/sql/driver"
 	"encoding/hex"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,11 +15,11 @@ func TestConvert(t *testing.T) {
 	var ts int64 = 1689905720186
 	bt := make([]byte, 12)
 	fromTimestamps(bt[:], ts)
-	printFormat("hex :\t [%s] \n", hex.EncodeToString(bt[:]))
+	t.Logf("hex : %s", hex.EncodeToString(bt[:]))
 	assert.Equal(hex.EncodeToString(bt[:]), "787b07150a0f14000b162280", "ts")
 	bt = make([]byte, 8)
 	fromDates(bt[:], ts)
-	printFormat("hex :\t [%s] \n", hex.EncodeToString(bt[:]))
+	t.Logf("hex : %s", hex.EncodeToString(bt[:]))
 	assert.Equal(hex.EncodeToString(bt[:]), "787b071500000000", "date")
 }
 
@@ -55,3 +57,122 @@ func TestScan(t *testing.T) {
 		assert.Equal("2023-01-02T20:18:01", str, "date")
 	}
 }
+
+func TestRowID(t *testing.T) {
+	assert := require.New(t)
+	raw, _ := hex.DecodeString("0000205a00020000412d0003")
+	id := DecodeRowID(raw)
+	assert.Equal(RowID("AAACBaAACAAAEEtAAD"), id)
+	seg, file, block, row, err := id.Parts()
+	assert.Nil(err)
+	assert.Equal(uint32(0x205a), seg)
+	assert.Equal(uint16(2), file)
+	assert.Equal(uint32(0x412d), block)
+	assert.Equal(uint16(3), row)
+	assert.False(id.IsLogical())
+
+	logical := DecodeRowID([]byte{0x02, 0x04, 0xc1, 0x02})
+	assert.Equal(RowID("*AgTBAg=="), logical)
+	assert.True(logical.IsLogical())
+	_, _, _, _, err = logical.Parts()
+	assert.NotNil(err)
+
+	// both forms are bound as the text they were decoded to
+	ps := &PrepareStatement{sql: "select 1 from T where ROWID = ? or ROWID = ?"}
+	assert.Nil(setting(ps, []driver.Value{id, logical}))
+	assert.Equal(StringBinder("AAACBaAACAAAEEtAAD"), ps.params.Front().Value)
+	assert.Equal(StringBinder("*AgTBAg=="), ps.params.Back().Value)
+}
+
+func TestDateTimeColumns(t *testing.T) {
+	assert := require.New(t)
+	decode := func(dtype uint32, data []byte) interface{} {
+		return des(CreateReader(nil, data, 0), dtype, uint32(len(data)))
+	}
+	at := time.Date(2023, 7, 21, 10, 15, 20, 123000000, time.Local)
+	// DATE and TIMESTAMP values are time.Time, not *time.Time
+	assert.Equal(time.Date(2023, 7, 21, 0, 0, 0, 0, time.Local), decode(DT_DATE, EncodeDate(at)))
+	assert.Equal(at, decode(DT_TIMESTAMP, EncodeTimestamp(at)))
+	// an empty value is NULL whatever the column type
+	for _, dtype := range []uint32{DT_DATE, DT_TIMESTAMP, DT_VARCHAR, DT_NUMBER, DT_RAW} {
+		assert.Nil(decode(dtype, nil), "type %d", dtype)
+	}
+}
+
+func TestScanBool(t *testing.T) {
+	assert := require.New(t)
+	var flag Bool
+	assert.Nil(flag.Scan(int64(1)))
+	assert.True(bool(flag))
+	assert.Nil(flag.Scan("N"))
+	assert.False(bool(flag))
+	assert.Nil(flag.Scan([]byte("yes")))
+	assert.True(bool(flag))
+	assert.NotNil(flag.Scan("maybe"))
+	assert.True(bool(flag))
+	assert.NotNil(flag.Scan(nil))
+	_, err := ParseBool("maybe")
+	assert.NotNil(err)
+}
+
+func TestDecimal(t *testing.T) {
+	assert := require.New(t)
+	cases := map[Decimal]float64{
+		"12300":     12300,
+		"-45":       -45,
+		"0.0012":    0.0012,
+		"-0.5":      -0.5,
+		"000.000":   0,
+		"123.45000": 123.45,
+	}
+	for dec, val := range cases {
+		expect, _ := EncodeFloat(val, 64)
+		mantissa, negative, exponent, err := dec.parts()
+		assert.Nil(err)
+		assert.Equal(hex.EncodeToString(expect), hex.EncodeToString(ToNumber(mantissa, negative, exponent)), string(dec))
+	}
+	_, err := ParseDecimal("12a.3")
+	assert.NotNil(err)
+	// boundaries of NUMBER
+	for _, str := range []string{
+		"1" + strings.Repeat("0", 125),
+		"0." + strings.Repeat("0", 129) + "1",
+		strings.Repeat("9", 40) + ".0",
+		"-0." + strings.Repeat("9", 40),
+		"1" + strings.Repeat("2", 38),
+	} {
+		_, err = ParseDecimal(str)
+		assert.Nil(err, str)
+	}
+	for _, str := range []string{
+		"1" + strings.Repeat("0", 126),
+		"0." + strings.Repeat("0", 130) + "1",
+		strings.Repeat("9", 41),
+		"-0." + strings.Repeat("9", 41),
+		// the padding digit of an even exponent counts
+		strings.Repeat("1", 40) + "0",
+	} {
+		_, err = ParseDecimal(str)
+		assert.ErrorIs(err, ErrNumberRange, str)
+	}
+	expect, _ := EncodeFloat(1e125, 64)
+	mantissa, negative, exponent, err := Decimal("1" + strings.Repeat("0", 125)).parts()
+	assert.Nil(err)
+	assert.Equal(expect, ToNumber(mantissa, negative, exponent))
+	var dec Decimal
+	assert.Nil(dec.Scan(int64(42)))
+	assert.Equal(Decimal("42"), dec)
+}
+
+func TestInterval(t *testing.T) {
+	assert := require.New(t)
+	ym := IntervalYM{Years: -3, Months: 11}
+	var buf [11]byte
+	fromIntervalYM(buf[:5], ym)
+	assert.Equal(ym, toIntervalYM(buf[:5]))
+	d := 50*time.Hour + 3*time.Minute + 4*time.Second + 5
+	ds := IntervalDSFromDuration(d)
+	assert.Equal(IntervalDS{Days: 2, Hours: 2, Minutes: 3, Seconds: 4, Nanos: 5}, ds)
+	fromIntervalDS(buf[:], ds)
+	assert.Equal(d, toIntervalDS(buf[:]).Duration())
+}
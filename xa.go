@@ -0,0 +1,231 @@
+package gibero
+
+import (
+	"fmt"
+	"time"
+)
+
+// XA flags, same values as the X/Open XA specification
+const (
+	TMNOFLAGS    uint32 = 0x00000000
+	TMJOIN       uint32 = 0x00200000
+	TMENDRSCAN   uint32 = 0x00800000
+	TMSTARTRSCAN uint32 = 0x01000000
+	TMSUSPEND    uint32 = 0x02000000
+	TMSUCCESS    uint32 = 0x04000000
+	TMRESUME     uint32 = 0x08000000
+	TMFAIL       uint32 = 0x20000000
+	TMONEPHASE   uint32 = 0x40000000
+)
+
+// XA return codes
+const (
+	XA_OK        = 0
+	XA_RDONLY    = 3
+	XA_HEURMIX   = 5
+	XA_HEURRB    = 6
+	XA_HEURCOM   = 7
+	XA_HEURHAZ   = 8
+	XA_RBBASE    = 100
+	XA_RBEND     = 107
+	XAER_RMERR   = -3
+	XAER_NOTA    = -4
+	XAER_INVAL   = -5
+	XAER_PROTO   = -6
+	XAER_RMFAIL  = -7
+	XAER_DUPID   = -8
+	XAER_OUTSIDE = -9
+)
+
+// Xid identifies a branch of a distributed transaction
+type Xid struct {
+	FormatID            int32
+	GlobalTransactionID []byte
+	BranchQualifier     []byte
+}
+
+func (xid *Xid) serialize(writer *ByteWriter) {
+	writer.WriteBig32(uint32(xid.FormatID))
+	writer.WriteDBString(string(xid.GlobalTransactionID))
+	writer.WriteDBString(string(xid.BranchQualifier))
+}
+
+func (xid *Xid) deserialize(reader *ByteReader) {
+	xid.FormatID = int32(reader.read32Big())
+	xid.GlobalTransactionID = []byte(reader.ReadDBString())
+	xid.BranchQualifier = []byte(reader.ReadDBString())
+}
+
+func (xid *Xid) check() error {
+	if len(xid.GlobalTransactionID) > 64 || len(xid.BranchQualifier) > 64 {
+		return &XAError{Code: XAER_INVAL}
+	}
+	return nil
+}
+
+// XAError reports an XA return code other than XA_OK and XA_RDONLY
+type XAError struct {
+	Code int32
+}
+
+func (e *XAError) Error() string {
+	switch {
+	case e.Code >= XA_RBBASE && e.Code <= XA_RBEND:
+		return fmt.Sprintf("xa: branch rolled back (%d)", e.Code)
+	}
+	switch e.Code {
+	case XA_HEURHAZ:
+		return "xa: branch may have been heuristically completed"
+	case XA_HEURCOM:
+		return "xa: branch has been heuristically committed"
+	case XA_HEURRB:
+		return "xa: branch has been heuristically rolled back"
+	case XA_HEURMIX:
+		return "xa: branch has been heuristically committed and rolled back"
+	case XAER_RMERR:
+		return "xa: resource manager error"
+	case XAER_NOTA:
+		return "xa: unknown xid"
+	case XAER_INVAL:
+		return "xa: invalid arguments"
+	case XAER_PROTO:
+		return "xa: routine invoked in an improper context"
+	case XAER_RMFAIL:
+		return "xa: resource manager unavailable"
+	case XAER_DUPID:
+		return "xa: duplicate xid"
+	case XAER_OUTSIDE:
+		return "xa: resource manager doing work outside the global transaction"
+	}
+	return fmt.Sprintf("xa: return code %d", e.Code)
+}
+
+// XAResource enlists the connection in distributed transactions driven by
+// an external transaction manager. Obtain it through sql.Conn.Raw:
+//
+//	conn.Raw(func(dc any) error {
+//		xa := dc.(*gibero.TConn).XAResource()
+//		return xa.Start(xid, gibero.TMNOFLAGS)
+//	})
+type XAResource struct {
+	conn    *TConn
+	timeout uint32
+}
+
+func (conn *TConn) XAResource() *XAResource {
+	return &XAResource{conn: conn}
+}
+
+// SetTransactionTimeout sets the timeout in seconds sent with the next Start,
+// 0 uses the server default
+func (xa *XAResource) SetTransactionTimeout(seconds uint32) {
+	xa.timeout = seconds
+}
+
+func (xa *XAResource) call(code Tibero_CMD_CODE, xid *Xid, flags uint32) (int32, error) {
+	err := xid.check()
+	if err != nil {
+		return 0, err
+	}
+	timeout := uint32(0)
+	if code == XA_START {
+		timeout = xa.timeout
+	}
+	xa.conn.tibero.logger.Debug("xa", "command", uint32(code), "formatId", xid.FormatID, "flags", flags)
+	start := time.Now()
+	msg, err := xa.conn.tibero.write(XA_CMD(code, xid, flags, timeout))
+	xa.conn.tibero.metrics.statement("xa", start, err)
+	if err != nil {
+		return 0, err
+	}
+	switch reply := msg.(type) {
+	case *OkReply:
+		return XA_OK, nil
+	case *TbMsgXaReply:
+		if reply.rc != XA_OK && reply.rc != XA_RDONLY {
+			return reply.rc, &XAError{Code: reply.rc}
+		}
+		return reply.rc, nil
+	}
+	return 0, unexpectedReply(msg)
+}
+
+// Start associates the connection with the branch xid.
+// flags is TMNOFLAGS, TMJOIN or TMRESUME.
+func (xa *XAResource) Start(xid *Xid, flags uint32) error {
+	if xa.conn.tx != nil || xa.conn.xaBranch != nil {
+		return &XAError{Code: XAER_OUTSIDE}
+	}
+	_, err := xa.call(XA_START, xid, flags)
+	if err != nil {
+		return err
+	}
+	branch := *xid
+	xa.conn.xaBranch = &branch
+	xa.conn.autoComit = 0
+	return nil
+}
+
+// End dissociates the connection from the branch xid.
+// flags is TMSUCCESS, TMFAIL or TMSUSPEND.
+func (xa *XAResource) End(xid *Xid, flags uint32) error {
+	_, err := xa.call(XA_END, xid, flags)
+	xa.conn.xaBranch = nil
+	xa.conn.autoComit = 1
+	return err
+}
+
+// Prepare asks the server to prepare the branch for commit. readOnly reports
+// that the branch did no update and has already been completed.
+func (xa *XAResource) Prepare(xid *Xid) (readOnly bool, err error) {
+	rc, err := xa.call(XA_PREPARE, xid, TMNOFLAGS)
+	if err != nil {
+		return false, err
+	}
+	return rc == XA_RDONLY, nil
+}
+
+// Commit commits the branch, in one phase without Prepare when onePhase is set
+func (xa *XAResource) Commit(xid *Xid, onePhase bool) error {
+	flags := TMNOFLAGS
+	if onePhase {
+		flags = TMONEPHASE
+	}
+	_, err := xa.call(XA_COMMIT, xid, flags)
+	return err
+}
+
+func (xa *XAResource) Rollback(xid *Xid) error {
+	_, err := xa.call(XA_ROLLBACK, xid, TMNOFLAGS)
+	return err
+}
+
+// Forget discards a heuristically completed branch
+func (xa *XAResource) Forget(xid *Xid) error {
+	_, err := xa.call(XA_FORGET, xid, TMNOFLAGS)
+	return err
+}
+
+// Recover lists the prepared or heuristically completed branches.
+// flags is a combination of TMSTARTRSCAN and TMENDRSCAN, or TMNOFLAGS.
+func (xa *XAResource) Recover(flags uint32) ([]Xid, error) {
+	start := time.Now()
+	msg, err := xa.conn.tibero.write(XA_RECOVER_CMD(flags))
+	xa.conn.tibero.metrics.statement("xa", start, err)
+	if err != nil {
+		return nil, err
+	}
+	switch reply := msg.(type) {
+	case *OkReply:
+		return nil, nil
+	case *TbMsgXaReply:
+		// a bare return code without xid list when nothing is in doubt
+		if reply.rc == XA_OK {
+			return nil, nil
+		}
+		return nil, &XAError{Code: reply.rc}
+	case *TbMsgXaRecoverReply:
+		return reply.xids, nil
+	}
+	return nil, unexpectedReply(msg)
+}
@@ -0,0 +1,70 @@
+package gibero
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXAResource(t *testing.T) {
+	assert := require.New(t)
+	rc := func(code int32) testReply {
+		writer := CreateWriter()
+		writer.WriteBig32(uint32(code))
+		return testReply{msgType: 68, body: writer.Data()}
+	}
+	xid := &Xid{FormatID: 1, GlobalTransactionID: []byte("gtrid"), BranchQualifier: []byte("b1")}
+	server := &okServer{replies: []testReply{rc(XA_OK), rc(XA_OK), rc(XA_RDONLY), rc(XAER_NOTA)}}
+	conn := &TConn{tibero: &Tibero{DBServer: server}, autoComit: 1}
+	xa := conn.XAResource()
+
+	assert.Nil(xa.Start(xid, TMNOFLAGS))
+	assert.Equal(uint32(0), conn.autoComit)
+	_, err := conn.Begin()
+	assert.Equal(errTxInProgress, err)
+	assert.Equal(XA_CMD(XA_START, xid, TMNOFLAGS, 0), server.sent[0])
+	assert.Nil(xa.End(xid, TMSUCCESS))
+	assert.Equal(uint32(1), conn.autoComit)
+	readOnly, err := xa.Prepare(xid)
+	assert.Nil(err)
+	assert.True(readOnly)
+	err = xa.Commit(xid, false)
+	assert.Equal(&XAError{Code: XAER_NOTA}, err)
+	assert.EqualError(err, "xa: unknown xid")
+
+	writer := CreateWriter()
+	writer.WriteBig32(1)
+	xid.serialize(writer)
+	server.replies = []testReply{{msgType: 69, body: writer.Data()}}
+	xids, err := xa.Recover(TMSTARTRSCAN | TMENDRSCAN)
+	assert.Nil(err)
+	assert.Equal([]Xid{*xid}, xids)
+	server.replies = []testReply{rc(XA_OK), rc(XAER_RMERR)}
+	xids, err = xa.Recover(TMSTARTRSCAN | TMENDRSCAN)
+	assert.Nil(err)
+	assert.Empty(xids)
+	_, err = xa.Recover(TMSTARTRSCAN | TMENDRSCAN)
+	assert.Equal(&XAError{Code: XAER_RMERR}, err)
+
+	// a branch left associated is ended and rolled back before the connection is reused
+	server.sent = nil
+	server.replies = []testReply{rc(XA_OK)}
+	assert.Nil(xa.Start(xid, TMNOFLAGS))
+	server.replies = []testReply{rc(XA_OK), rc(XA_OK)}
+	assert.Nil(conn.ResetSession(context.Background()))
+	assert.Equal([][]byte{
+		XA_CMD(XA_START, xid, TMNOFLAGS, 0),
+		XA_CMD(XA_END, xid, TMFAIL, 0),
+		XA_CMD(XA_ROLLBACK, xid, TMNOFLAGS, 0),
+	}, server.sent)
+	assert.Nil(conn.xaBranch)
+	assert.Equal(uint32(1), conn.autoComit)
+
+	// the connection is discarded when the branch can not be rolled back
+	server.replies = []testReply{rc(XA_OK)}
+	assert.Nil(xa.Start(xid, TMNOFLAGS))
+	server.replies = []testReply{rc(XA_OK), rc(XAER_RMERR)}
+	assert.Equal(driver.ErrBadConn, conn.ResetSession(context.Background()))
+}